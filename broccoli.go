@@ -1,15 +1,25 @@
 package broccoli
 
 import (
+	"encoding"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"math/big"
 	"os"
 	"path/filepath"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
+	"unicode/utf8"
 )
 
 // command represents the internal structure for a CLI command.
@@ -24,29 +34,72 @@ type command struct {
 	About       *string      `json:"about,omitempty"`
 	LongAbout   *string      `json:"long_about,omitempty"`
 	Version     *string      `json:"version,omitempty"`
+	EnvPrefix   *string      `json:"env_prefix,omitempty"`
 	Flags       []fieldMeta  `json:"flags"`
+	Groups      []flagGroup  `json:"groups,omitempty"`
 	SubCommands []command    `json:"subcommands"`
 	Help        string       `json:"help"`
 }
 
+// flagGroup is a set of flags of a command that are checked together, e.g. mutually exclusive flags.
+type flagGroup struct {
+	Name     string   `json:"name"`
+	Kind     string   `json:"kind"`
+	Flags    []string `json:"flags"`
+	Required bool     `json:"required"`
+
+	flags []int
+}
+
+// usage formats the group as "(--json | --yaml | --table)".
+func (g *flagGroup) usage() string {
+	return "(--" + strings.Join(g.Flags, " | --") + ")"
+}
+
 type fieldMeta struct {
-	Type     reflect.Type `json:"-"`
-	Name     string       `json:"name"`
-	Kind     string       `json:"kind"`
-	About    string       `json:"about"`
-	Index    int          `json:"index"`
-	Default  *string      `json:"default,omitempty"`
-	Env      *string      `json:"env,omitempty"`
-	Alias    *string      `json:"alias,omitempty"`
-	Required bool         `json:"required"`
+	Type        reflect.Type `json:"-"`
+	Name        string       `json:"name"`
+	Kind        string       `json:"kind"`
+	About       string       `json:"about"`
+	Index       int          `json:"index"`
+	Default     *string      `json:"default,omitempty"`
+	Env         []string     `json:"-"`
+	EnvName     *string      `json:"env,omitempty"`
+	EnvFallback []string     `json:"env_fallback,omitempty"`
+	EnvFile     *bool        `json:"env_file,omitempty"`
+	Alias       *string      `json:"alias,omitempty"`
+	Encoding    *string      `json:"encoding,omitempty"`
+	Choices     []string     `json:"choices,omitempty"`
+	Min         *string      `json:"min,omitempty"`
+	Max         *string      `json:"max,omitempty"`
+	MinLen      *int         `json:"min_len,omitempty"`
+	MaxLen      *int         `json:"max_len,omitempty"`
+	Pattern     *string      `json:"pattern,omitempty"`
+	PatternMsg  *string      `json:"pattern_msg,omitempty"`
+	Path        *string      `json:"path,omitempty"`
+	Required    bool         `json:"required"`
+
+	Config       bool `json:"config,omitempty"`
+	Configurable bool `json:"configurable,omitempty"`
+
+	Requires       []string `json:"requires,omitempty"`
+	RequiredIf     []string `json:"required_if,omitempty"`
+	RequiredUnless []string `json:"required_unless,omitempty"`
+
+	choiceValues []reflect.Value
+	minRat       *big.Rat
+	maxRat       *big.Rat
+	patternRe    *regexp.Regexp
+	path         *pathOptions
+	plainSplit   bool
+	noEnv        bool
+	noConfig     bool
 }
 
 // ErrTypeNotSupported is returned when a field type is not supported.
 var ErrTypeNotSupported = errors.New("broccoli: type not supported")
 
 func buildCommand(rt reflect.Type, parent *command, commandName string) (*command, error) {
-	var err error
-
 	for rt.Kind() == reflect.Pointer {
 		rt = rt.Elem()
 	}
@@ -61,11 +114,20 @@ func buildCommand(rt reflect.Type, parent *command, commandName string) (*comman
 		Type:     rt,
 	}
 
+	// Problems are collected so that NewApp can report every mistake in the tags at once.
+	var problems []string
+	problem := func(field string, format string, args ...interface{}) {
+		problems = append(problems, rt.String()+"."+field+": "+fmt.Sprintf(format, args...))
+	}
+
 	for i := 0; i < rt.NumField(); i++ {
 		f := rt.Field(i)
 		st := f.Tag
 
 		if f.Type.Kind() == reflect.Struct && f.Type.NumField() == 0 {
+			for _, key := range unknownTagKeys(st, commandTags) {
+				problem(f.Name, "unknown tag key %s", strconv.Quote(key))
+			}
 			if v, ok := st.Lookup("command"); ok {
 				cmd.Command = v
 			}
@@ -81,6 +143,9 @@ func buildCommand(rt reflect.Type, parent *command, commandName string) (*comman
 			if v, ok := st.Lookup("version"); ok {
 				cmd.Version = &v
 			}
+			if v, ok := st.Lookup("env_prefix"); ok {
+				cmd.EnvPrefix = &v
+			}
 			continue
 		}
 
@@ -90,9 +155,20 @@ func buildCommand(rt reflect.Type, parent *command, commandName string) (*comman
 		}
 
 		if v, ok := st.Lookup("subcommand"); ok {
+			for _, key := range unknownTagKeys(st, subcommandTags) {
+				problem(f.Name, "unknown tag key %s", strconv.Quote(key))
+			}
 			subcmd, err := buildCommand(f.Type, cmd, v)
 			if err != nil {
-				return nil, err
+				var de *DefinitionError
+				if !errors.As(err, &de) {
+					problem(f.Name, "%v", err)
+					continue
+				}
+				problems = append(problems, de.Problems...)
+			}
+			if subcmd == nil {
+				continue
 			}
 			subcmd.Index = i
 			cmd.SubCommands = append(cmd.SubCommands, *subcmd)
@@ -100,46 +176,497 @@ func buildCommand(rt reflect.Type, parent *command, commandName string) (*comman
 		}
 
 		if v, ok := st.Lookup("flag"); ok {
+			for _, key := range unknownTagKeys(st, flagTags) {
+				problem(f.Name, "unknown tag key %s", strconv.Quote(key))
+			}
+
 			var t reflect.Type = f.Type
 			for t.Kind() == reflect.Ptr {
 				t = t.Elem()
 			}
 			fm := fieldMeta{
 				Name:  v,
-				Kind:  t.Kind().String(),
+				Kind:  kindName(t),
 				Index: i,
 			}
 			if v, ok := st.Lookup("default"); ok {
 				fm.Default = &v
 			}
 			if v, ok := st.Lookup("env"); ok {
-				fm.Env = &v
+				if v == "-" {
+					fm.noEnv = true
+				} else {
+					fm.Env = splitNames(v)
+				}
+			}
+			if v, ok := st.Lookup("env_file"); ok {
+				envFile, err := strconv.ParseBool(v)
+				switch {
+				case err != nil:
+					problem(f.Name, "can not parse env_file %s as bool", strconv.Quote(v))
+				case envFile && fm.noEnv:
+					problem(f.Name, "env_file is set but env is \"-\"")
+				default:
+					fm.EnvFile = &envFile
+				}
 			}
 			if v, ok := st.Lookup("alias"); ok {
 				fm.Alias = &v
 			}
+			if v, ok := st.Lookup("encoding"); ok {
+				switch {
+				case v != "hex" && v != "base64" && v != "base64url" && v != "raw":
+					problem(f.Name, "unknown encoding %s", strconv.Quote(v))
+				case t.Kind() != reflect.Slice || t.Elem().Kind() != reflect.Uint8:
+					problem(f.Name, "encoding is only supported on []byte fields")
+				default:
+					fm.Encoding = &v
+				}
+			}
+			if v, ok := st.Lookup("csv"); ok {
+				csv, err := strconv.ParseBool(v)
+				if err != nil {
+					problem(f.Name, "can not parse csv %s as bool", strconv.Quote(v))
+				}
+				fm.plainSplit = !csv
+			}
+			if v, ok := st.Lookup("choices"); ok && t.Kind() == reflect.Bool {
+				// Bool flags set on the command line take no value to check
+				problem(f.Name, "choices is not supported on bool flags")
+			} else if ok {
+				ct := t
+				if fm.Encoding == nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+					ct = t.Elem()
+				}
+				// Elements are compared behind their pointers, as validate dereferences them
+				for ct.Kind() == reflect.Pointer {
+					ct = ct.Elem()
+				}
+				for _, c := range strings.Split(v, ",") {
+					c = strings.TrimSpace(c)
+					cv := reflect.New(ct).Elem()
+					if err := fm.setValue(cv, c); err != nil {
+						problem(f.Name, "can not parse choice %s as %s", strconv.Quote(c), kindName(ct))
+						continue
+					}
+					fm.Choices = append(fm.Choices, c)
+					fm.choiceValues = append(fm.choiceValues, cv)
+				}
+			}
 			if v, ok := st.Lookup("required"); ok {
-				fm.Required, err = strconv.ParseBool(v)
+				required, err := strconv.ParseBool(v)
 				if err != nil {
-					return nil, err
+					problem(f.Name, "can not parse required %s as bool", strconv.Quote(v))
 				}
+				fm.Required = required
 			}
 			if v, ok := st.Lookup("about"); ok {
 				fm.About = v
 			}
+			if err := fm.parseConstraints(t, st); err != nil {
+				problem(f.Name, "%v", err)
+			}
+			if v, ok := st.Lookup("xor"); ok {
+				var required bool
+				if r, ok := st.Lookup("xor_required"); ok {
+					var err error
+					required, err = strconv.ParseBool(r)
+					if err != nil {
+						problem(f.Name, "can not parse xor_required %s as bool", strconv.Quote(r))
+					}
+				}
+				cmd.addToGroup("xor", v, len(cmd.Flags), fm.Name, required)
+				if fm.Default != nil {
+					// A default would conflict with every other member, or satisfy xor_required on its own
+					problem(f.Name, "default can not be used with xor")
+				}
+			}
+			if v, ok := st.Lookup("at_least_one_of"); ok {
+				cmd.addToGroup("at_least_one_of", v, len(cmd.Flags), fm.Name, true)
+				if fm.Default != nil {
+					problem(f.Name, "default can not be used with at_least_one_of")
+				}
+			}
+			if v, ok := st.Lookup("requires"); ok {
+				fm.Requires = splitNames(v)
+			}
+			if v, ok := st.Lookup("required_if"); ok {
+				fm.RequiredIf = splitNames(v)
+			}
+			if v, ok := st.Lookup("required_unless"); ok {
+				fm.RequiredUnless = splitNames(v)
+			}
+			if v, ok := st.Lookup("config"); ok {
+				if v == "-" {
+					fm.noConfig = true
+				} else if config, err := strconv.ParseBool(v); err != nil {
+					problem(f.Name, "can not parse config %s as bool", strconv.Quote(v))
+				} else if config && t.Kind() != reflect.String {
+					problem(f.Name, "config is only supported on string flags")
+				} else {
+					fm.Config = config
+				}
+			}
+			fm.Configurable = !fm.Config && !fm.noConfig
+
+			// Defaults are parsed into a scratch value, so mistakes show up before binding.
+			if fm.Default != nil {
+				scratch := reflect.New(f.Type).Elem()
+				if err := fm.setValue(scratch, *fm.Default); err != nil && err != errCanNotSet {
+					problem(f.Name, "can not parse default %s as %s", strconv.Quote(*fm.Default), fm.typeName())
+				}
+			}
+
 			cmd.Flags = append(cmd.Flags, fm)
 			continue
 		}
 	}
 
+	// Check names and aliases for collisions
+	for i := range cmd.Flags {
+		field := rt.Field(cmd.Flags[i].Index).Name
+		if cmd.Flags[i].Name == "help" {
+			problem(field, "flag name \"help\" collides with --help")
+		}
+		if cmd.Flags[i].Alias != nil && *cmd.Flags[i].Alias == "h" {
+			problem(field, "alias \"h\" collides with -h")
+		}
+		for j := 0; j < i; j++ {
+			if cmd.Flags[j].Name == cmd.Flags[i].Name {
+				problem(field, "duplicate flag name %s (also used by %s)", strconv.Quote(cmd.Flags[i].Name), rt.Field(cmd.Flags[j].Index).Name)
+			}
+			if cmd.Flags[i].Alias != nil && cmd.Flags[j].Alias != nil && *cmd.Flags[j].Alias == *cmd.Flags[i].Alias {
+				problem(field, "duplicate alias %s (also used by %s)", strconv.Quote(*cmd.Flags[i].Alias), rt.Field(cmd.Flags[j].Index).Name)
+			}
+		}
+	}
+	for i := range cmd.SubCommands {
+		for j := 0; j < i; j++ {
+			if cmd.SubCommands[j].Command == cmd.SubCommands[i].Command {
+				problem(rt.Field(cmd.SubCommands[i].Index).Name, "duplicate subcommand name %s (also used by %s)", strconv.Quote(cmd.SubCommands[i].Command), rt.Field(cmd.SubCommands[j].Index).Name)
+			}
+		}
+	}
+
+	// Only one flag can name the config file
+	for i := range cmd.Flags {
+		for j := 0; j < i; j++ {
+			if cmd.Flags[i].Config && cmd.Flags[j].Config {
+				problem(rt.Field(cmd.Flags[i].Index).Name, "only one flag can name the config file (also set on %s)", rt.Field(cmd.Flags[j].Index).Name)
+			}
+		}
+	}
+
+	// Check that conditions refer to flags of this command
+	for i := range cmd.Flags {
+		for _, conditions := range [][]string{cmd.Flags[i].Requires, cmd.Flags[i].RequiredIf, cmd.Flags[i].RequiredUnless} {
+			for _, c := range conditions {
+				if cmd.flagIndex(conditionFlag(c)) < 0 {
+					problem(rt.Field(cmd.Flags[i].Index).Name, "refers to unknown flag %s", strconv.Quote(conditionFlag(c)))
+				}
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return cmd, &DefinitionError{Problems: problems}
+	}
 	return cmd, nil
 }
 
+// ErrInvalidDefinition is returned by NewApp when the tags of the command structs are inconsistent.
+var ErrInvalidDefinition = errors.New("broccoli: invalid command definition")
+
+// DefinitionError lists every problem found in the tags of the command structs,
+// each prefixed with the struct and field name.
+type DefinitionError struct {
+	Problems []string
+}
+
+func (e *DefinitionError) Error() string {
+	return ErrInvalidDefinition.Error() + ":\n\t" + strings.Join(e.Problems, "\n\t")
+}
+
+// Unwrap returns ErrInvalidDefinition.
+func (e *DefinitionError) Unwrap() error {
+	return ErrInvalidDefinition
+}
+
+// Tag keys known for command marker fields, subcommand fields and flag fields.
+// Keys of other packages that commonly share the same structs are accepted as well.
+var (
+	commandTags    = tagSet("command", "author", "about", "long_about", "version", "env_prefix")
+	subcommandTags = tagSet("subcommand", "about")
+	flagTags       = tagSet("flag", "about", "default", "env", "env_file", "alias", "required", "encoding", "csv", "choices",
+		"min", "max", "min_len", "max_len", "pattern", "pattern_msg", "path",
+		"xor", "xor_required", "at_least_one_of", "requires", "required_if", "required_unless", "config")
+	foreignTags = tagSet("json", "yaml", "toml", "xml", "mapstructure")
+)
+
+func tagSet(keys ...string) map[string]bool {
+	m := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		m[k] = true
+	}
+	return m
+}
+
+// unknownTagKeys returns the keys of st that are neither in known nor foreign tags.
+func unknownTagKeys(st reflect.StructTag, known map[string]bool) []string {
+	var unknown []string
+	for _, key := range tagKeys(st) {
+		if !known[key] && !foreignTags[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	return unknown
+}
+
+// tagKeys returns the keys of a struct tag in the conventional key:"value" format.
+func tagKeys(st reflect.StructTag) []string {
+	var keys []string
+	tag := string(st)
+	for tag != "" {
+		// Skip leading space.
+		i := 0
+		for i < len(tag) && tag[i] == ' ' {
+			i++
+		}
+		tag = tag[i:]
+		if tag == "" {
+			break
+		}
+
+		// Scan to colon. A space, a quote or a control character is a syntax error.
+		i = 0
+		for i < len(tag) && tag[i] > ' ' && tag[i] != ':' && tag[i] != '"' && tag[i] != 0x7f {
+			i++
+		}
+		if i == 0 || i+1 >= len(tag) || tag[i] != ':' || tag[i+1] != '"' {
+			break
+		}
+		keys = append(keys, tag[:i])
+		tag = tag[i+1:]
+
+		// Scan quoted string to find value.
+		i = 1
+		for i < len(tag) && tag[i] != '"' {
+			if tag[i] == '\\' {
+				i++
+			}
+			i++
+		}
+		if i >= len(tag) {
+			break
+		}
+		tag = tag[i+1:]
+	}
+	return keys
+}
+
+// splitNames splits a comma separated list of names, ignoring surrounding spaces.
+func splitNames(v string) []string {
+	names := strings.Split(v, ",")
+	for i := range names {
+		names[i] = strings.TrimSpace(names[i])
+	}
+	return names
+}
+
+// setPathLookup sets the function the path flags of cmd and its subcommands use to read HOME.
+func (cmd *command) setPathLookup(lookup func(string) (string, bool)) {
+	for i := range cmd.Flags {
+		if cmd.Flags[i].path != nil {
+			cmd.Flags[i].path.lookupEnv = lookup
+		}
+	}
+	for i := range cmd.SubCommands {
+		cmd.SubCommands[i].setPathLookup(lookup)
+	}
+}
+
+// deriveEnvNames sets the environment variable names of the flags without an env tag in the whole tree.
+// It runs once the tree is complete, so env_prefix may be declared anywhere in a command struct.
+func (cmd *command) deriveEnvNames() {
+	for i := range cmd.Flags {
+		if len(cmd.Flags[i].Env) == 0 && !cmd.Flags[i].noEnv {
+			cmd.Flags[i].Env = cmd.deriveEnv(cmd.Flags[i].Name)
+		}
+		// The schema keeps env as the first name, with the fallback names listed separately
+		if env := cmd.Flags[i].Env; len(env) > 0 {
+			cmd.Flags[i].EnvName = &env[0]
+			cmd.Flags[i].EnvFallback = env[1:]
+		}
+	}
+	for i := range cmd.SubCommands {
+		cmd.SubCommands[i].Parent = cmd
+		cmd.SubCommands[i].deriveEnvNames()
+	}
+}
+
+// deriveEnv returns the environment variable name for the flag name, built from the nearest env_prefix
+// and the names of the subcommands below the command that declares it, e.g. MYAPP_DB_HOST.
+// It returns nil if no command on the path declares an env_prefix.
+func (cmd *command) deriveEnv(name string) []string {
+	parts := []string{name}
+	for c := cmd; c != nil; c = c.Parent {
+		if c.EnvPrefix != nil {
+			if *c.EnvPrefix != "" {
+				parts = append([]string{*c.EnvPrefix}, parts...)
+			}
+			return []string{envName(strings.Join(parts, "_"))}
+		}
+		parts = append([]string{c.Command}, parts...)
+	}
+	return nil
+}
+
+// envName converts s to the conventional form of an environment variable name.
+func envName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// path returns the names of the commands from the root to cmd, separated by spaces.
+func (cmd *command) path() string {
+	var names []string
+	for c := cmd; c != nil; c = c.Parent {
+		names = append([]string{c.Command}, names...)
+	}
+	return strings.Join(names, " ")
+}
+
+// flagIndex returns the index of the flag with the given name, or -1.
+func (cmd *command) flagIndex(name string) int {
+	for i := range cmd.Flags {
+		if cmd.Flags[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseConstraints reads the min, max, min_len, max_len, pattern and path tags of a flag of type t.
+func (f *fieldMeta) parseConstraints(t reflect.Type, st reflect.StructTag) error {
+	et := t
+	if isList(t) && f.Encoding == nil {
+		et = t.Elem()
+	}
+	for et.Kind() == reflect.Pointer {
+		et = et.Elem()
+	}
+
+	for _, c := range []struct {
+		key string
+		dst **string
+		rat **big.Rat
+	}{{"min", &f.Min, &f.minRat}, {"max", &f.Max, &f.maxRat}} {
+		v, ok := st.Lookup(c.key)
+		if !ok {
+			continue
+		}
+		if !isNumeric(et) {
+			return fmt.Errorf("%s is only supported on numeric flags", c.key)
+		}
+		r, ok := new(big.Rat).SetString(v)
+		if !ok {
+			return fmt.Errorf("can not parse %s %s", c.key, strconv.Quote(v))
+		}
+		*c.dst = &v
+		*c.rat = r
+	}
+
+	for _, c := range []struct {
+		key string
+		dst **int
+	}{{"min_len", &f.MinLen}, {"max_len", &f.MaxLen}} {
+		v, ok := st.Lookup(c.key)
+		if !ok {
+			continue
+		}
+		switch t.Kind() {
+		case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		default:
+			return fmt.Errorf("%s is only supported on string and slice flags", c.key)
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return fmt.Errorf("can not parse %s %s", c.key, strconv.Quote(v))
+		}
+		*c.dst = &n
+	}
+
+	if v, ok := st.Lookup("pattern"); ok {
+		if et.Kind() != reflect.String {
+			return errors.New("pattern is only supported on string flags")
+		}
+		re, err := regexp.Compile("^(?:" + v + ")$")
+		if err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+		f.Pattern = &v
+		f.patternRe = re
+	}
+	if v, ok := st.Lookup("path"); ok {
+		if et.Kind() != reflect.String {
+			return errors.New("path is only supported on string flags")
+		}
+		po, err := parsePathOptions(v)
+		if err != nil {
+			return fmt.Errorf("invalid path options: %w", err)
+		}
+		f.Path = &v
+		f.path = po
+	}
+	if v, ok := st.Lookup("pattern_msg"); ok {
+		if f.Pattern == nil {
+			return errors.New("pattern_msg requires a pattern")
+		}
+		f.PatternMsg = &v
+	}
+	return nil
+}
+
+// addToGroup adds the flag at index i to the group with the given kind and name, creating the group if needed.
+func (cmd *command) addToGroup(kind, name string, i int, flag string, required bool) {
+	for j := range cmd.Groups {
+		if cmd.Groups[j].Kind == kind && cmd.Groups[j].Name == name {
+			cmd.Groups[j].Flags = append(cmd.Groups[j].Flags, flag)
+			cmd.Groups[j].flags = append(cmd.Groups[j].flags, i)
+			cmd.Groups[j].Required = cmd.Groups[j].Required || required
+			return
+		}
+	}
+	cmd.Groups = append(cmd.Groups, flagGroup{
+		Name:     name,
+		Kind:     kind,
+		Flags:    []string{flag},
+		Required: required,
+		flags:    []int{i},
+	})
+}
+
+// kindName returns the kind reported for a flag of type t.
+// Types with a registered parser or a TextUnmarshaler implementation are reported by their type name.
+func kindName(t reflect.Type) string {
+	if _, ok := lookupParser(t); ok || reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return t.String()
+	}
+	return t.Kind().String()
+}
+
 var ErrTypeMismatch = errors.New("broccoli: type mismatch")
 var ErrMissingRequiredField = errors.New("broccoli: missing required field")
 var ErrHelp = errors.New("broccoli: help requested")
 
-func bindCommand(cmd *command, args []string, dst reflect.Value) ([]string, *command, error) {
+func (a *App) bindCommand(cmd *command, args []string, dst reflect.Value) ([]string, *command, error) {
 	cmd.init()
 	for dst.Kind() == reflect.Pointer {
 		if dst.IsNil() {
@@ -160,16 +687,29 @@ func bindCommand(cmd *command, args []string, dst reflect.Value) ([]string, *com
 		// Check SubCommands
 		for i := range cmd.SubCommands {
 			if cmd.SubCommands[i].Command == args[0] {
-				return bindCommand(&cmd.SubCommands[i], args[1:], dst.Field(cmd.SubCommands[i].Index))
+				return a.bindCommand(&cmd.SubCommands[i], args[1:], dst.Field(cmd.SubCommands[i].Index))
 			}
 		}
 	}
 
 	var err error
+	var errs Errors
+	// report records err and returns true if binding should stop.
+	// Unless the App collects all errors, binding stops at the first error.
+	report := func(err error) bool {
+		if e, ok := err.(*Error); ok && e.Command == "" {
+			e.Command = cmd.path()
+		}
+		errs = append(errs, err)
+		return !a.allErrors
+	}
+
 	var wfb [32]string
 	// WrittenFields tracks which flags were explicitly set by arguments
 	var WrittenFields []string = wfb[:0]
 	var MaxIndex int = 0
+	// configArg is the value of the config flag of a parent command given as an argument, if any
+	var configArg *string
 
 	for i := 0; i < len(args); i++ {
 		hasLongPrefix := strings.HasPrefix(args[i], "--")
@@ -215,29 +755,34 @@ func bindCommand(cmd *command, args []string, dst reflect.Value) ([]string, *com
 					}
 
 					if i+1 >= len(args) {
-						return nil, cmd, fmt.Errorf("%s requires %s", name, cmd.Flags[j].Kind)
+						report(&Error{
+							Kind:   KindMissingValue,
+							Flag:   cmd.Flags[j].Name,
+							Source: SourceArg,
+							msg:    fmt.Sprintf("%s requires %s", name, cmd.Flags[j].Kind),
+						})
+						return nil, cmd, errs.result(a.allErrors)
 					}
 					value := args[i+1]
 
-					err = setValue(DstField, value)
-
-					switch err {
-					case errCanNotParse:
-						// Parse Error
-						return nil, cmd, fmt.Errorf("can not parse %s as %s", strconv.Quote(value), cmd.Flags[j].Kind)
-					case errCanNotSet:
-						// Ignore Error
-					case nil:
-						// No Error
-					default:
-						// Unknown Error
-						return nil, cmd, err
+					err = cmd.Flags[j].apply(DstField, value, valueSource{kind: SourceArg})
+					if err != nil && report(err) {
+						return nil, cmd, errs.result(a.allErrors)
 					}
 					WrittenFields = append(WrittenFields, args[i])
 					i++
 					break
 				}
 			}
+			if !Found && i+1 < len(args) {
+				// The config flag of a parent command can be given after the subcommand
+				if f := cmd.inheritedConfigFlag(); f != nil && ((hasLongPrefix && f.Name == name) ||
+					(!hasLongPrefix && f.Alias != nil && *f.Alias == name)) {
+					configArg = &args[i+1]
+					i++
+					goto skip
+				}
+			}
 			if !Found {
 				// Handle Help
 				if args[i] == "--help" || args[i] == "-h" {
@@ -252,8 +797,30 @@ func bindCommand(cmd *command, args []string, dst reflect.Value) ([]string, *com
 		MaxIndex = i
 	}
 
+	// Sources records where the value of each flag came from, empty if the flag is unset
+	var Sources []valueSource = make([]valueSource, len(cmd.Flags))
+
+	// The config file is loaded once the flags naming it are bound, which come first in bindOrder
+	var config *configValue
+	var configLoaded bool
+	loadConfig := func() bool {
+		configLoaded = true
+		var cerrs Errors
+		config, cerrs = a.loadConfig(cmd, dst, Sources, configArg)
+		for _, err := range cerrs {
+			if report(err) {
+				return true
+			}
+		}
+		return false
+	}
+
 	// Check Fields and Apply Defaults/Env
-	for i := range cmd.Flags {
+	for _, i := range cmd.bindOrder() {
+		if !configLoaded && !cmd.Flags[i].Config && loadConfig() {
+			return nil, cmd, errs.result(a.allErrors)
+		}
+
 		var Found bool = false
 		for j := range WrittenFields {
 			if strings.HasPrefix(WrittenFields[j], "--") {
@@ -272,147 +839,1227 @@ func bindCommand(cmd *command, args []string, dst reflect.Value) ([]string, *com
 			}
 		}
 
+		if Found {
+			Sources[i] = valueSource{kind: SourceArg}
+		}
+
 		// If the flag was NOT provided in arguments
 		if !Found {
 			// 1. Try Environment Variable
-			if cmd.Flags[i].Env != nil {
-				if val, ok := os.LookupEnv(*cmd.Flags[i].Env); ok {
+			// The first variable that is set wins
+			if len(cmd.Flags[i].Env) > 0 {
+				source, val, ok, err := a.lookupFlagEnv(&cmd.Flags[i], a.processEnv)
+				if !ok && err == nil && a.dotEnv != nil {
+					source, val, ok, err = a.lookupFlagEnv(&cmd.Flags[i], a.dotEnv.lookup)
+				}
+				if err != nil {
+					Sources[i] = source
+					if report(err) {
+						return nil, cmd, errs.result(a.allErrors)
+					}
+					continue
+				}
+				if ok {
 					DstField := dst.Field(cmd.Flags[i].Index)
-					err = setValue(DstField, val)
-					switch err {
-					case errCanNotParse:
-						return nil, cmd, fmt.Errorf("can not parse (env %s) %s as %s", *cmd.Flags[i].Env, strconv.Quote(val), cmd.Flags[i].Kind)
-					case errCanNotSet:
-						// Ignore Error
-					case nil:
-						// No Error
-					default:
-						return nil, cmd, err
+					Sources[i] = source
+					err = cmd.Flags[i].apply(DstField, val, Sources[i])
+					if err != nil && report(err) {
+						return nil, cmd, errs.result(a.allErrors)
 					}
 					continue
 				}
 			}
 
-			// 2. Try Default Value
+			// 2. Try Config File
+			if v := config.get(cmd.Flags[i].Name); v != nil && cmd.Flags[i].Configurable {
+				DstField := dst.Field(cmd.Flags[i].Index)
+				Sources[i] = valueSource{kind: SourceConfig, name: cmd.configKey(cmd.Flags[i].Name), origin: v.pos}
+				err = cmd.Flags[i].applyConfig(DstField, v, Sources[i])
+				if err != nil && report(err) {
+					return nil, cmd, errs.result(a.allErrors)
+				}
+				continue
+			}
+
+			// 3. Try Default Value
 			if cmd.Flags[i].Default != nil {
 				DstField := dst.Field(cmd.Flags[i].Index)
-				err = setValue(DstField, *cmd.Flags[i].Default)
-				switch err {
-				case errCanNotParse:
-					return nil, cmd, fmt.Errorf("can not parse (default value) %s as %s", strconv.Quote(*cmd.Flags[i].Default), cmd.Flags[i].Kind)
-				case errCanNotSet:
-					// Ignore Error
-				case nil:
-					// No Error
-				default:
-					return nil, cmd, err
+				Sources[i] = valueSource{kind: SourceDefault}
+				err = cmd.Flags[i].apply(DstField, *cmd.Flags[i].Default, Sources[i])
+				if err != nil && report(err) {
+					return nil, cmd, errs.result(a.allErrors)
 				}
 				continue
 			}
 
-			// 3. Check Required
+			// 4. Check Required
 			if cmd.Flags[i].Required {
-				return nil, cmd, fmt.Errorf("required parameter %s is missing", cmd.Flags[i].Name)
+				if report(&Error{
+					Kind: KindMissingRequired,
+					Flag: cmd.Flags[i].Name,
+					msg:  fmt.Sprintf("required parameter %s is missing", cmd.Flags[i].Name),
+				}) {
+					return nil, cmd, errs.result(a.allErrors)
+				}
 			}
 		}
 	}
 
+	if !configLoaded && loadConfig() {
+		return nil, cmd, errs.result(a.allErrors)
+	}
+
+	for _, err := range append(cmd.checkGroups(Sources), cmd.checkConditions(dst, Sources)...) {
+		report(err)
+	}
+	if len(errs) > 0 {
+		return nil, cmd, errs.result(a.allErrors)
+	}
+
 	if len(args) <= 0 {
 		return args[0:], cmd, nil
 	}
 	return args[MaxIndex+1:], cmd, nil
 }
 
-var errCanNotParse = errors.New("cannot parse value")
-var errCanNotSet = errors.New("cannot set value")
-
-func setValue(dst reflect.Value, value string) error {
-	var err error
+// processEnv looks up the environment variable name of the process.
+func (a *App) processEnv(name string) (string, valueSource, bool) {
+	val, ok := a.lookupEnv(name)
+	return val, valueSource{kind: SourceEnv, name: name}, ok
+}
 
-	for dst.Kind() == reflect.Pointer {
-		if dst.IsNil() {
-			dst.Set(reflect.New(dst.Type().Elem()))
+// lookupFlagEnv returns the source and value of the first environment variable of f that lookup finds.
+// If secret files are enabled for f, NAME_FILE names a file holding the value of NAME, as in the
+// Docker and Kubernetes secret convention. Setting both NAME and NAME_FILE is an error.
+func (a *App) lookupFlagEnv(f *fieldMeta, lookup func(string) (string, valueSource, bool)) (valueSource, string, bool, error) {
+	files := a.envFiles
+	if f.EnvFile != nil {
+		files = *f.EnvFile
+	}
+	for _, name := range f.Env {
+		val, source, ok := lookup(name)
+		if files {
+			if file, fileSource, fok := lookup(name + "_FILE"); fok {
+				if ok {
+					return fileSource, "", false, &Error{
+						Kind:       KindConflict,
+						Flag:       f.Name,
+						Source:     fileSource.kind,
+						SourceName: fileSource.name,
+						msg:        fmt.Sprintf("%s and %s are both set for --%s", source, fileSource, f.Name),
+					}
+				}
+				variable := fileSource.String()
+				fileSource.file = file
+				b, err := os.ReadFile(file)
+				if err != nil {
+					reason := err
+					var pe *fs.PathError
+					if errors.As(err, &pe) {
+						reason = pe.Err
+					}
+					return fileSource, "", false, &Error{
+						Kind:       KindInvalidValue,
+						Flag:       f.Name,
+						Source:     fileSource.kind,
+						SourceName: fileSource.name,
+						Err:        err,
+						msg:        fmt.Sprintf("can not read %s for --%s (from %s): %v", fileSource, f.Name, variable, reason),
+					}
+				}
+				val = strings.TrimSuffix(string(b), "\n")
+				val = strings.TrimSuffix(val, "\r")
+				return fileSource, val, true, nil
+			}
+		}
+		if ok {
+			return source, val, true, nil
 		}
-		dst = dst.Elem()
 	}
+	return valueSource{}, "", false, nil
+}
 
-	if !dst.CanSet() {
-		return errCanNotSet
+// checkGroups checks the flag groups of cmd against the sources of the bound flags.
+func (cmd *command) checkGroups(sources []valueSource) Errors {
+	var errs Errors
+	for _, g := range cmd.Groups {
+		var set []string
+		for _, j := range g.flags {
+			if sources[j].set() {
+				set = append(set, fmt.Sprintf("--%s (from %s)", cmd.Flags[j].Name, sources[j]))
+			}
+		}
+
+		switch g.Kind {
+		case "xor":
+			if len(set) > 1 {
+				errs = append(errs, &Error{
+					Kind: KindConflict,
+					msg:  fmt.Sprintf("%s can not be used together, only one of %s may be set", strings.Join(set, ", "), g.usage()),
+				})
+			}
+			if len(set) == 0 && g.Required {
+				errs = append(errs, &Error{
+					Kind: KindMissingRequired,
+					msg:  fmt.Sprintf("one of %s is required", g.usage()),
+				})
+			}
+		case "at_least_one_of":
+			if len(set) == 0 {
+				errs = append(errs, &Error{
+					Kind: KindMissingRequired,
+					msg:  fmt.Sprintf("at least one of %s is required", g.usage()),
+				})
+			}
+		}
 	}
+	return errs
+}
 
-	switch dst.Kind() {
-	case reflect.String:
-		dst.SetString(value)
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		var val int64
-		if strings.HasPrefix(value, "0x") || strings.HasPrefix(value, "0X") ||
-			strings.HasPrefix(value, "-0x") || strings.HasPrefix(value, "-0X") ||
-			strings.HasPrefix(value, "+0x") || strings.HasPrefix(value, "+0X") {
-			val, err = strconv.ParseInt(value[2:], 16, 64)
-		} else if strings.HasPrefix(value, "0b") || strings.HasPrefix(value, "0B") ||
-			strings.HasPrefix(value, "-0b") || strings.HasPrefix(value, "-0B") ||
-			strings.HasPrefix(value, "+0b") || strings.HasPrefix(value, "+0B") {
-			val, err = strconv.ParseInt(value[2:], 2, 64)
-		} else if strings.HasPrefix(value, "0o") || strings.HasPrefix(value, "0O") ||
-			strings.HasPrefix(value, "-0o") || strings.HasPrefix(value, "-0O") ||
-			strings.HasPrefix(value, "+0o") || strings.HasPrefix(value, "+0O") {
-			val, err = strconv.ParseInt(value[2:], 8, 64)
-		} else {
-			val, err = strconv.ParseInt(value, 10, 64)
+// checkConditions checks the requires, required_if and required_unless conditions of the flags of cmd.
+func (cmd *command) checkConditions(dst reflect.Value, sources []valueSource) Errors {
+	var errs Errors
+	for i := range cmd.Flags {
+		f := &cmd.Flags[i]
+
+		if sources[i].set() {
+			for _, name := range f.Requires {
+				if !sources[cmd.flagIndex(name)].set() {
+					errs = append(errs, &Error{
+						Kind: KindMissingRequired,
+						Flag: name,
+						msg:  fmt.Sprintf("--%s (from %s) requires --%s", f.Name, sources[i], name),
+					})
+				}
+			}
+			continue
 		}
-		if err != nil {
-			return errCanNotParse
+
+		var reported bool
+		for _, c := range f.RequiredIf {
+			if cmd.conditionHolds(dst, sources, c) {
+				errs = append(errs, &Error{
+					Kind: KindMissingRequired,
+					Flag: f.Name,
+					msg:  fmt.Sprintf("--%s is required because --%s (from %s)", f.Name, c, sources[cmd.flagIndex(conditionFlag(c))]),
+				})
+				reported = true
+				break
+			}
 		}
-		dst.SetInt(val)
-	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		var val uint64
-		if strings.HasPrefix(value, "0x") || strings.HasPrefix(value, "0X") ||
-			strings.HasPrefix(value, "-0x") || strings.HasPrefix(value, "-0X") ||
-			strings.HasPrefix(value, "+0x") || strings.HasPrefix(value, "+0X") {
-			val, err = strconv.ParseUint(value[2:], 16, 64)
-		} else if strings.HasPrefix(value, "0b") || strings.HasPrefix(value, "0B") ||
-			strings.HasPrefix(value, "-0b") || strings.HasPrefix(value, "-0B") ||
-			strings.HasPrefix(value, "+0b") || strings.HasPrefix(value, "+0B") {
-			val, err = strconv.ParseUint(value[2:], 2, 64)
-		} else if strings.HasPrefix(value, "0o") || strings.HasPrefix(value, "0O") ||
-			strings.HasPrefix(value, "-0o") || strings.HasPrefix(value, "-0O") ||
-			strings.HasPrefix(value, "+0o") || strings.HasPrefix(value, "+0O") {
-			val, err = strconv.ParseUint(value[2:], 8, 64)
-		} else {
-			val, err = strconv.ParseUint(value, 10, 64)
+
+		if len(f.RequiredUnless) > 0 && !reported {
+			var satisfied bool
+			for _, c := range f.RequiredUnless {
+				if cmd.conditionHolds(dst, sources, c) {
+					satisfied = true
+					break
+				}
+			}
+			if !satisfied {
+				errs = append(errs, &Error{
+					Kind: KindMissingRequired,
+					Flag: f.Name,
+					msg:  fmt.Sprintf("--%s is required unless %s", f.Name, conditionsString(f.RequiredUnless)),
+				})
+			}
 		}
+	}
+	return errs
+}
+
+// conditionFlag returns the name of the flag a condition ("mode" or "mode=server") refers to.
+func conditionFlag(c string) string {
+	name, _, _ := strings.Cut(c, "=")
+	return name
+}
+
+// conditionHolds reports whether the flag named by c is set, and has the given value for "name=value" conditions.
+func (cmd *command) conditionHolds(dst reflect.Value, sources []valueSource, c string) bool {
+	name, value, hasValue := strings.Cut(c, "=")
+	j := cmd.flagIndex(name)
+	if !sources[j].set() {
+		return false
+	}
+	if !hasValue {
+		return true
+	}
+
+	field := dst.Field(cmd.Flags[j].Index)
+	want := reflect.New(field.Type()).Elem()
+	if err := cmd.Flags[j].setValue(want, value); err != nil {
+		return false
+	}
+	for field.Kind() == reflect.Pointer && want.Kind() == reflect.Pointer {
+		if field.IsNil() {
+			return false
+		}
+		field, want = field.Elem(), want.Elem()
+	}
+	return reflect.DeepEqual(field.Interface(), want.Interface())
+}
+
+// conditionsString formats conditions for error messages, e.g. "--config is set or --mode=local".
+func conditionsString(conditions []string) string {
+	parts := make([]string, len(conditions))
+	for i, c := range conditions {
+		if strings.Contains(c, "=") {
+			parts[i] = "--" + c
+		} else {
+			parts[i] = "--" + c + " is set"
+		}
+	}
+	return strings.Join(parts, " or ")
+}
+
+var errCanNotParse = errors.New("cannot parse value")
+var errCanNotSet = errors.New("cannot set value")
+
+// errRedacted replaces the cause of an error about a value read from a file, as the cause may quote the secret.
+var errRedacted = errors.New("the reason is not shown for values read from files")
+
+// parserResultError reports a registered parser that returned a value that can not be converted to its type.
+type parserResultError struct {
+	typ reflect.Type
+	val interface{}
+}
+
+func (e *parserResultError) Error() string {
+	if e.val == nil {
+		return fmt.Sprintf("the parser registered for %s returned nil", e.typ)
+	}
+	return fmt.Sprintf("the parser registered for %s returned %T", e.typ, e.val)
+}
+
+var errWrongLength = errors.New("wrong number of elements")
+var errInvalidChoice = errors.New("not one of the possible values")
+var errOutOfRange = errors.New("out of range")
+var errInvalidLength = errors.New("invalid length")
+var errPatternMismatch = errors.New("does not match pattern")
+var errOddHexLength = errors.New("odd length hex string")
+var errBadPadding = errors.New("bad base64 padding")
+
+// typeName returns a human readable name of the value a flag expects.
+func (f *fieldMeta) typeName() string {
+	if f.Encoding != nil {
+		return *f.Encoding
+	}
+	return f.Kind
+}
+
+// apply parses value into dst and validates the result.
+// source describes where the value came from.
+func (f *fieldMeta) apply(dst reflect.Value, value string, source valueSource) error {
+	return f.applyWith(dst, value, strconv.Quote(value), source, func() error {
+		return f.setValue(dst, value)
+	})
+}
+
+// applyWith sets dst with set and reports errors like apply. value and shown are the raw value and its
+// representation in error messages.
+func (f *fieldMeta) applyWith(dst reflect.Value, value, shown string, source valueSource, set func() error) error {
+	e := &Error{
+		Flag:       f.Name,
+		Value:      value,
+		Source:     source.kind,
+		SourceName: source.name,
+	}
+	// Values read from files are secrets, so neither the value nor reasons that may quote it are shown
+	if source.file != "" {
+		e.Value = ""
+		shown = "the contents"
+	}
+
+	err := set()
+	var pe *parserResultError
+	switch {
+	case errors.As(err, &pe):
+		// A broken parser is not the fault of the value
+		e.Kind = KindInvalidValue
+		e.Err = err
+		e.msg = fmt.Sprintf("invalid value %s for --%s (from %s): %v", shown, f.Name, source, err)
+		return e
+	case err == errCanNotParse, err != nil && err != errCanNotSet && source.file != "":
+		// Parse Error
+		e.Kind = KindParse
+		if err != errCanNotParse {
+			e.Err = errRedacted
+		}
+		e.msg = fmt.Sprintf("can not parse %s as %s for --%s (from %s)", shown, f.typeName(), f.Name, source)
+		return e
+	case err == errCanNotSet:
+		// Ignore Error
+		return nil
+	case err == nil:
+		// No Error
+	default:
+		// Parse Error with a reason
+		e.Kind = KindParse
+		e.Err = err
+		e.msg = fmt.Sprintf("can not parse %s as %s for --%s (from %s): %v", shown, f.typeName(), f.Name, source, err)
+		return e
+	}
+
+	if err := f.validate(dst); err != nil {
+		e.Kind = KindInvalidValue
+		e.Err = err
+		// The reasons of validation errors may reveal the secret, e.g. its length or its path
+		if source.file != "" {
+			e.Err = errRedacted
+			e.msg = fmt.Sprintf("invalid value %s for --%s (from %s)", shown, f.Name, source)
+			return e
+		}
+		e.msg = fmt.Sprintf("invalid value %s for --%s (from %s): %v", shown, f.Name, source, err)
+		return e
+	}
+	return nil
+}
+
+// validate checks a parsed value against the constraints declared on the flag.
+func (f *fieldMeta) validate(v reflect.Value) error {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	// Constraints on the elements of a list apply to every element.
+	var elems []reflect.Value
+	if isList(v.Type()) && f.Encoding == nil {
+		for i := 0; i < v.Len(); i++ {
+			elems = append(elems, v.Index(i))
+		}
+	} else {
+		elems = append(elems, v)
+	}
+
+	for _, e := range elems {
+		for e.Kind() == reflect.Pointer && !e.IsNil() {
+			e = e.Elem()
+		}
+		if e.Kind() == reflect.Pointer {
+			// A nil element has no value to check
+			continue
+		}
+		if len(f.choiceValues) > 0 && !f.isChoice(e) {
+			return fmt.Errorf("%w (%s)", errInvalidChoice, strings.Join(f.Choices, ", "))
+		}
+		if f.minRat != nil || f.maxRat != nil {
+			r := ratOf(e)
+			if r == nil || (f.minRat != nil && r.Cmp(f.minRat) < 0) || (f.maxRat != nil && r.Cmp(f.maxRat) > 0) {
+				return fmt.Errorf("%w: range %s", errOutOfRange, rangeString(f.Min, f.Max))
+			}
+		}
+		if f.path != nil {
+			if err := f.path.check(e.String()); err != nil {
+				return err
+			}
+		}
+		if f.patternRe != nil && !f.patternRe.MatchString(e.String()) {
+			if f.PatternMsg != nil {
+				return fmt.Errorf("%w: %s", errPatternMismatch, *f.PatternMsg)
+			}
+			return fmt.Errorf("%w %s", errPatternMismatch, strconv.Quote(*f.Pattern))
+		}
+	}
+
+	if f.MinLen != nil || f.MaxLen != nil {
+		var n int
+		if v.Kind() == reflect.String {
+			n = utf8.RuneCountInString(v.String())
+		} else {
+			n = v.Len()
+		}
+		if (f.MinLen != nil && n < *f.MinLen) || (f.MaxLen != nil && n > *f.MaxLen) {
+			return fmt.Errorf("%w: length %d, allowed %s", errInvalidLength, n, rangeString(optionalItoa(f.MinLen), optionalItoa(f.MaxLen)))
+		}
+	}
+	return nil
+}
+
+// pathOptions holds the options of the path tag, e.g. path:"file,exists".
+type pathOptions struct {
+	kind   string // "file", "dir" or empty for any kind
+	exists bool
+	create bool
+	abs    bool
+
+	// lookupEnv reads HOME, os.LookupEnv unless the App was created with WithLookupEnv
+	lookupEnv func(string) (string, bool)
+}
+
+var errNotAFile = errors.New("not a regular file")
+var errNotADir = errors.New("not a directory")
+
+func parsePathOptions(v string) (*pathOptions, error) {
+	po := &pathOptions{}
+	for _, o := range splitNames(v) {
+		switch o {
+		case "file", "dir":
+			if po.kind != "" && po.kind != o {
+				return nil, errors.New("file and dir can not be combined")
+			}
+			po.kind = o
+		case "exists":
+			po.exists = true
+		case "create":
+			po.create = true
+		case "abs":
+			po.abs = true
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown option %s", strconv.Quote(o))
+		}
+	}
+	if po.create && po.kind == "" {
+		return nil, errors.New("create requires file or dir")
+	}
+	return po, nil
+}
+
+// resolve expands ~ and $HOME in p and makes it absolute if requested.
+func (po *pathOptions) resolve(p string) (string, error) {
+	p, err := expandHome(p, po.lookupEnv)
+	if err != nil {
+		return "", err
+	}
+	if po.abs && p != "" {
+		p, err = filepath.Abs(p)
+		if err != nil {
+			return "", err
+		}
+	}
+	return p, nil
+}
+
+// check checks the existence and type of p. It has no side effects: a path that does not exist yet passes
+// with create, and is created by createPaths once binding succeeded.
+func (po *pathOptions) check(p string) error {
+	fi, err := os.Stat(p)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && (!po.exists || po.create) {
+			return nil
+		}
+		return err
+	}
+
+	switch {
+	case po.kind == "file" && !fi.Mode().IsRegular():
+		return fmt.Errorf("%s: %w", p, errNotAFile)
+	case po.kind == "dir" && !fi.IsDir():
+		return fmt.Errorf("%s: %w", p, errNotADir)
+	}
+	return nil
+}
+
+// expandHome replaces a leading ~ and every $HOME or ${HOME} in p with the home directory,
+// read from HOME, or USERPROFILE on Windows, with lookupEnv. A nil lookupEnv uses os.UserHomeDir.
+func expandHome(p string, lookupEnv func(string) (string, bool)) (string, error) {
+	var home string
+	getHome := func() (string, error) {
+		if home != "" {
+			return home, nil
+		}
+		if lookupEnv == nil {
+			h, err := os.UserHomeDir()
+			if err != nil {
+				return "", err
+			}
+			home = h
+			return home, nil
+		}
+		for _, name := range []string{"HOME", "USERPROFILE"} {
+			if h, ok := lookupEnv(name); ok && h != "" {
+				home = h
+				return home, nil
+			}
+		}
+		return "", errors.New("$HOME is not defined")
+	}
+
+	if p == "~" || strings.HasPrefix(p, "~/") || strings.HasPrefix(p, "~"+string(filepath.Separator)) {
+		h, err := getHome()
+		if err != nil {
+			return "", err
+		}
+		p = h + p[1:]
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(p); i++ {
+		var n int
+		if strings.HasPrefix(p[i:], "${HOME}") {
+			n = len("${HOME}")
+		} else if strings.HasPrefix(p[i:], "$HOME") && (i+5 == len(p) || !isIdentByte(p[i+5])) {
+			n = len("$HOME")
+		}
+		if n == 0 {
+			sb.WriteByte(p[i])
+			continue
+		}
+		h, err := getHome()
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(h)
+		i += n - 1
+	}
+	return sb.String(), nil
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || ('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+// ratOf converts a numeric value to a big.Rat.
+// It returns nil for values that are not finite numbers.
+func ratOf(v reflect.Value) *big.Rat {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return new(big.Rat).SetInt64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return new(big.Rat).SetUint64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		if math.IsNaN(v.Float()) || math.IsInf(v.Float(), 0) {
+			return nil
+		}
+		return new(big.Rat).SetFloat64(v.Float())
+	}
+	if !v.CanAddr() {
+		return nil
+	}
+	switch n := v.Addr().Interface().(type) {
+	case *big.Int:
+		return new(big.Rat).SetInt(n)
+	case *big.Float:
+		if n.IsInf() {
+			return nil
+		}
+		r, _ := n.Rat(nil)
+		return r
+	case *big.Rat:
+		return n
+	}
+	return nil
+}
+
+// isNumeric reports whether min and max constraints can be checked on values of type t.
+func isNumeric(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	switch t {
+	case reflect.TypeOf(big.Int{}), reflect.TypeOf(big.Float{}), reflect.TypeOf(big.Rat{}):
+		return true
+	}
+	return false
+}
+
+// rangeString formats a range such as "1..65535", "1.." or "..10".
+func rangeString(lo, hi *string) string {
+	var sb strings.Builder
+	if lo != nil {
+		sb.WriteString(*lo)
+	}
+	sb.WriteString("..")
+	if hi != nil {
+		sb.WriteString(*hi)
+	}
+	return sb.String()
+}
+
+func optionalItoa(v *int) *string {
+	if v == nil {
+		return nil
+	}
+	s := strconv.Itoa(*v)
+	return &s
+}
+
+func (f *fieldMeta) isChoice(v reflect.Value) bool {
+	for i := range f.choiceValues {
+		if reflect.DeepEqual(f.choiceValues[i].Interface(), v.Interface()) {
+			return true
+		}
+	}
+	return false
+}
+
+// setValue parses value into dst, honoring the per-flag options such as encoding.
+func (f *fieldMeta) setValue(dst reflect.Value, value string) error {
+	if f.Encoding == nil && !f.plainSplit && f.path == nil {
+		return setValue(dst, value)
+	}
+
+	for dst.Kind() == reflect.Pointer {
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		dst = dst.Elem()
+	}
+	if !dst.CanSet() {
+		return errCanNotSet
+	}
+
+	if f.Encoding != nil {
+		b, err := decodeBytes(value, *f.Encoding)
+		if err != nil {
+			return err
+		}
+		dst.SetBytes(b)
+		return nil
+	}
+
+	if isList(dst.Type()) {
+		var values []string
+		if f.plainSplit {
+			// csv:"false" keeps the legacy behavior of splitting on every comma.
+			values = strings.Split(value, ",")
+		} else {
+			var err error
+			values, err = splitList(value)
+			if err != nil {
+				return err
+			}
+		}
+		return f.setList(dst, values)
+	}
+
+	if f.path != nil {
+		p, err := f.path.resolve(value)
+		if err != nil {
+			return err
+		}
+		value = p
+	}
+	return setValue(dst, value)
+}
+
+var errNotAList = errors.New("the flag does not take a list")
+
+// setValues sets the slice or array flag dst from values that are already split, e.g. a list from a config file.
+func (f *fieldMeta) setValues(dst reflect.Value, values []string) error {
+	for dst.Kind() == reflect.Pointer {
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		dst = dst.Elem()
+	}
+	if !dst.CanSet() {
+		return errCanNotSet
+	}
+	if f.Encoding != nil || !isList(dst.Type()) {
+		return errNotAList
+	}
+	return f.setList(dst, values)
+}
+
+// setList sets the slice or array dst from values, resolving them first for path flags.
+func (f *fieldMeta) setList(dst reflect.Value, values []string) error {
+	if f.path != nil {
+		for i := range values {
+			p, err := f.path.resolve(values[i])
+			if err != nil {
+				return err
+			}
+			values[i] = p
+		}
+	}
+	return setList(dst, values)
+}
+
+var errNotAMap = errors.New("the flag does not take a table")
+
+// setMapValues sets the map flag dst from keys and values that are already split, e.g. a table from a config file.
+func (f *fieldMeta) setMapValues(dst reflect.Value, keys, values []string) error {
+	for dst.Kind() == reflect.Pointer {
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		dst = dst.Elem()
+	}
+	if !dst.CanSet() {
+		return errCanNotSet
+	}
+	if dst.Kind() != reflect.Map {
+		return errNotAMap
+	}
+	return setMap(dst, keys, values)
+}
+
+// decodeBytes decodes value using one of the supported byte encodings.
+// base64 requires padding, base64url accepts both padded and unpadded input.
+func decodeBytes(value, encoding string) ([]byte, error) {
+	switch encoding {
+	case "hex":
+		if len(value)%2 != 0 {
+			return nil, errOddHexLength
+		}
+		b, err := hex.DecodeString(value)
+		if err != nil {
+			return nil, err
+		}
+		return b, nil
+	case "base64":
+		if len(value)%4 != 0 {
+			return nil, errBadPadding
+		}
+		return decodeBase64(base64.StdEncoding, value)
+	case "base64url":
+		if strings.HasSuffix(value, "=") {
+			if len(value)%4 != 0 {
+				return nil, errBadPadding
+			}
+			return decodeBase64(base64.URLEncoding, value)
+		}
+		if len(value)%4 == 1 {
+			return nil, errBadPadding
+		}
+		return decodeBase64(base64.RawURLEncoding, value)
+	case "raw":
+		return []byte(value), nil
+	}
+	return nil, fmt.Errorf("unknown encoding %s", strconv.Quote(encoding))
+}
+
+func decodeBase64(enc *base64.Encoding, value string) ([]byte, error) {
+	b, err := enc.DecodeString(value)
+	if err != nil {
+		// Misplaced '=' characters are reported as corrupt input at the padding position.
+		if e, ok := err.(base64.CorruptInputError); ok && int(e) < len(value) && strings.Contains(value[e:], "=") {
+			return nil, errBadPadding
+		}
+		return nil, err
+	}
+	return b, nil
+}
+
+func setValue(dst reflect.Value, value string) error {
+	var err error
+
+	for dst.Kind() == reflect.Pointer {
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		dst = dst.Elem()
+	}
+
+	if !dst.CanSet() {
+		return errCanNotSet
+	}
+
+	if parse, ok := lookupParser(dst.Type()); ok {
+		val, err := parse(value)
+		if err != nil {
+			return err
+		}
+		rv := reflect.ValueOf(val)
+		if !rv.IsValid() || !rv.Type().ConvertibleTo(dst.Type()) {
+			return &parserResultError{typ: dst.Type(), val: val}
+		}
+		dst.Set(rv.Convert(dst.Type()))
+		return nil
+	}
+
+	switch v := dst.Addr().Interface().(type) {
+	case *big.Int:
+		digits, base := splitBasePrefix(value)
+		if _, ok := v.SetString(digits, base); !ok {
+			return errCanNotParse
+		}
+		return nil
+	case *big.Float:
+		// The precision grows with the input, so that no given digit is lost: 4 bits per character cover
+		// decimal, hexadecimal and binary mantissas
+		prec := uint(4 * len(value))
+		if prec < 64 {
+			prec = 64
+		}
+		if _, ok := v.SetPrec(prec).SetString(value); !ok {
+			return errCanNotParse
+		}
+		return nil
+	case *big.Rat:
+		if a, b, ok := strings.Cut(value, "/"); ok {
+			var num, denom big.Int
+			da, baseA := splitBasePrefix(a)
+			db, baseB := splitBasePrefix(b)
+			if _, ok := num.SetString(da, baseA); !ok {
+				return errCanNotParse
+			}
+			if _, ok := denom.SetString(db, baseB); !ok || denom.Sign() == 0 {
+				return errCanNotParse
+			}
+			v.SetFrac(&num, &denom)
+			return nil
+		}
+		if _, ok := v.SetString(value); !ok {
+			return errCanNotParse
+		}
+		return nil
+	}
+
+	if u, ok := dst.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(value))
+	}
+
+	switch dst.Kind() {
+	case reflect.String:
+		dst.SetString(value)
+	case reflect.Bool:
+		var val bool
+		val, err = strconv.ParseBool(value)
+		if err != nil {
+			return errCanNotParse
+		}
+		dst.SetBool(val)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var val int64
+		digits, base := splitBasePrefix(value)
+		val, err = strconv.ParseInt(digits, base, dst.Type().Bits())
+		if err != nil {
+			return errCanNotParse
+		}
+		dst.SetInt(val)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var val uint64
+		digits, base := splitBasePrefix(value)
+		val, err = strconv.ParseUint(digits, base, dst.Type().Bits())
 		if err != nil {
 			return errCanNotParse
 		}
 		dst.SetUint(val)
 	case reflect.Float32, reflect.Float64:
 		var val float64
-		val, err = strconv.ParseFloat(value, 64)
+		val, err = strconv.ParseFloat(value, dst.Type().Bits())
 		if err != nil {
 			return errCanNotParse
 		}
 		dst.SetFloat(val)
-	case reflect.Slice:
-		val := strings.Split(value, ",")
-		if dst.Cap() < len(val) {
-			dst.Set(reflect.MakeSlice(dst.Type(), len(val), len(val)))
-		} else {
-			dst.SetLen(len(val))
+	case reflect.Complex64, reflect.Complex128:
+		var val complex128
+		val, err = strconv.ParseComplex(value, dst.Type().Bits())
+		if err != nil {
+			return errCanNotParse
 		}
-		for i := 0; i < len(val); i++ {
-			err = setValue(dst.Index(i), val[i])
+		dst.SetComplex(val)
+	case reflect.Slice, reflect.Array:
+		var val []string
+		val, err = splitList(value)
+		if err != nil {
+			return err
+		}
+		return setList(dst, val)
+	case reflect.Map:
+		var keys, values []string
+		if value != "" {
+			var pairs []string
+			pairs, err = splitList(value)
 			if err != nil {
 				return err
 			}
+			for _, pair := range pairs {
+				k, v, ok := strings.Cut(pair, "=")
+				if !ok {
+					return fmt.Errorf("%w: %s", errMissingMapValue, strconv.Quote(pair))
+				}
+				keys, values = append(keys, k), append(values, v)
+			}
 		}
+		return setMap(dst, keys, values)
 	}
 	return err
 }
 
+var errMissingMapValue = errors.New("expected key=value")
+
+// setMap replaces the map dst with the entries of keys and values.
+func setMap(dst reflect.Value, keys, values []string) error {
+	m := reflect.MakeMapWithSize(dst.Type(), len(keys))
+	for i := range keys {
+		k := reflect.New(dst.Type().Key()).Elem()
+		if err := setValue(k, keys[i]); err != nil {
+			return err
+		}
+		v := reflect.New(dst.Type().Elem()).Elem()
+		if err := setValue(v, values[i]); err != nil {
+			return err
+		}
+		m.SetMapIndex(k, v)
+	}
+	dst.Set(m)
+	return nil
+}
+
+// isList reports whether values of type t are parsed as comma separated lists.
+func isList(t reflect.Type) bool {
+	if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+		return false
+	}
+	if _, ok := lookupParser(t); ok {
+		return false
+	}
+	return !reflect.PointerTo(t).Implements(textUnmarshalerType)
+}
+
+// setList sets the elements of the slice or array dst from values.
+func setList(dst reflect.Value, values []string) error {
+	if dst.Kind() == reflect.Array {
+		if len(values) != dst.Len() {
+			return fmt.Errorf("%w: expected %d, got %d", errWrongLength, dst.Len(), len(values))
+		}
+	} else if dst.Cap() < len(values) {
+		dst.Set(reflect.MakeSlice(dst.Type(), len(values), len(values)))
+	} else {
+		dst.SetLen(len(values))
+	}
+	for i := 0; i < len(values); i++ {
+		if err := setValue(dst.Index(i), values[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var errUnterminatedQuote = errors.New("unterminated quoted value")
+var errBareQuote = errors.New("unexpected character after closing quote")
+
+// splitList splits a comma separated list using CSV quoting rules.
+// A value enclosed in double quotes may contain commas, and a doubled quote ("") inside it stands for a single quote.
+// Quotes inside an unquoted value are kept as is.
+func splitList(value string) ([]string, error) {
+	var values []string
+	var sb strings.Builder
+	for i := 0; ; {
+		if i < len(value) && value[i] == '"' {
+			// Quoted value
+			sb.Reset()
+			i++
+			for {
+				j := strings.IndexByte(value[i:], '"')
+				if j < 0 {
+					return nil, errUnterminatedQuote
+				}
+				sb.WriteString(value[i : i+j])
+				i += j + 1
+				if i < len(value) && value[i] == '"' {
+					sb.WriteByte('"')
+					i++
+					continue
+				}
+				break
+			}
+			if i < len(value) && value[i] != ',' {
+				return nil, errBareQuote
+			}
+			values = append(values, sb.String())
+		} else {
+			j := strings.IndexByte(value[i:], ',')
+			if j < 0 {
+				j = len(value) - i
+			}
+			values = append(values, value[i:i+j])
+			i += j
+		}
+
+		if i >= len(value) {
+			return values, nil
+		}
+		// Skip the separator
+		i++
+	}
+}
+
+// splitBasePrefix strips a 0x, 0b or 0o prefix (after an optional sign) from value
+// and returns the remaining digits together with the base the prefix selects.
+func splitBasePrefix(value string) (string, int) {
+	sign, digits := "", value
+	if strings.HasPrefix(digits, "-") || strings.HasPrefix(digits, "+") {
+		sign, digits = digits[:1], digits[1:]
+	}
+	if len(digits) > 2 && digits[0] == '0' {
+		switch digits[1] {
+		case 'x', 'X':
+			return sign + digits[2:], 16
+		case 'b', 'B':
+			return sign + digits[2:], 2
+		case 'o', 'O':
+			return sign + digits[2:], 8
+		}
+	}
+	return value, 10
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+var parsersMu sync.RWMutex
+var parsers = map[reflect.Type]func(string) (interface{}, error){
+	reflect.TypeOf(time.Duration(0)): func(s string) (interface{}, error) {
+		return time.ParseDuration(s)
+	},
+}
+
+// RegisterParser registers a parse function for flags of type typ.
+// The value returned by parse must be assignable or convertible to typ.
+// Registered parsers take precedence over encoding.TextUnmarshaler and the built-in conversions,
+// and are also used for the elements of slices and arrays of typ.
+func RegisterParser(typ reflect.Type, parse func(string) (interface{}, error)) {
+	parsersMu.Lock()
+	defer parsersMu.Unlock()
+	parsers[typ] = parse
+}
+
+func lookupParser(typ reflect.Type) (func(string) (interface{}, error), bool) {
+	parsersMu.RLock()
+	defer parsersMu.RUnlock()
+	parse, ok := parsers[typ]
+	return parse, ok
+}
+
 // App represents the main application structure for the CLI.
 // It holds the command configuration and provides methods to bind arguments and generate help/schema.
 type App struct {
 	c *command
+
+	allErrors     bool
+	usageExitCode int
+	envFiles      bool
+
+	name      string
+	args      []string
+	hasArgs   bool
+	lookupEnv func(string) (string, bool)
+	stdout    io.Writer
+	stderr    io.Writer
+	exit      func(int)
+
+	dotEnvPaths []string
+	dotEnv      dotEnv
+
+	configFile      string
+	configDiscovery bool
+	configHelp      bool
+	configSearch    []string
+}
+
+// Option configures an App created by NewApp.
+type Option func(*App)
+
+// WithAllErrors makes Bind report every parse error, missing required flag and validation failure of the
+// selected command at once instead of stopping at the first one. The errors are returned as Errors.
+func WithAllErrors() Option {
+	return func(a *App) {
+		a.allErrors = true
+	}
+}
+
+// WithUsageExitCode sets the exit status BindOSArgs and Exit use for usage errors, e.g. ExitUsage.
+// The default is 2.
+func WithUsageExitCode(code int) Option {
+	return func(a *App) {
+		a.usageExitCode = code
+	}
+}
+
+// WithEnvFiles makes every flag read from an environment variable also accept NAME_FILE, the path of a file
+// holding the value, as Docker and Kubernetes do for secrets. A single trailing newline is removed. Flags
+// can opt in or out on their own with the env_file tag.
+func WithEnvFiles() Option {
+	return func(a *App) {
+		a.envFiles = true
+	}
+}
+
+// WithName sets the program name used for the root command instead of the name of the executable.
+// A command tag on the root struct still takes precedence.
+func WithName(name string) Option {
+	return func(a *App) {
+		a.name = name
+	}
+}
+
+// WithArgs sets the arguments Run and BindOSArgs parse instead of os.Args[1:].
+func WithArgs(args []string) Option {
+	return func(a *App) {
+		a.args = args
+		a.hasArgs = true
+	}
+}
+
+// WithLookupEnv sets the function used to read environment variables instead of os.LookupEnv,
+// e.g. a lookup in a map for tests.
+func WithLookupEnv(lookup func(string) (string, bool)) Option {
+	return func(a *App) {
+		a.lookupEnv = lookup
+	}
+}
+
+// WithOutput sets the writer Run and BindOSArgs print the help message to instead of os.Stdout.
+func WithOutput(w io.Writer) Option {
+	return func(a *App) {
+		a.stdout = w
+	}
+}
+
+// WithErrOutput sets the writer Run and BindOSArgs print errors to instead of os.Stderr.
+func WithErrOutput(w io.Writer) Option {
+	return func(a *App) {
+		a.stderr = w
+	}
+}
+
+// WithExit sets the function BindOSArgs calls to terminate the program instead of os.Exit.
+func WithExit(exit func(code int)) Option {
+	return func(a *App) {
+		a.exit = exit
+	}
+}
+
+// WithDotEnv loads the dotenv files paths as an environment layer consulted after the environment of the process
+// and before defaults. Later files override earlier ones and missing files are skipped. The files support comments,
+// an export prefix, single-quoted literal values, double-quoted values with escapes, and $NAME, ${NAME} and
+// ${NAME:-default} references. The environment of the process is never changed.
+func WithDotEnv(paths ...string) Option {
+	return func(a *App) {
+		a.dotEnvPaths = append(a.dotEnvPaths, paths...)
+	}
+}
+
+// WithConfigFile sets the config file read for the flags that are not given as arguments or environment variables.
+// A flag with the config tag, if set, names the file instead. The format is chosen by the extension of path.
+func WithConfigFile(path string) Option {
+	return func(a *App) {
+		a.configFile = path
+	}
+}
+
+// WithConfigDiscovery makes Bind look for config files when none is named by a config flag or WithConfigFile:
+// /etc/<app>/config.*, then $XDG_CONFIG_HOME/<app>/config.* or ~/.config/<app>/config.*, then ./.<app>rc,
+// where <app> is the name of the root command. The files that exist are merged, later files overriding
+// earlier ones, so project settings win over user settings and user settings over system settings.
+func WithConfigDiscovery() Option {
+	return func(a *App) {
+		a.configDiscovery = true
+	}
+}
+
+// WithConfigPathsInHelp adds the config files that are read to the help message of every command:
+// the file set with WithConfigFile, or else the search path of WithConfigDiscovery.
+func WithConfigPathsInHelp() Option {
+	return func(a *App) {
+		a.configHelp = true
+	}
+}
+
+// sub returns a copy of a for the command cmd.
+func (a *App) sub(cmd *command) App {
+	s := *a
+	s.c = cmd
+	return s
 }
 
 // Help returns the generated help message string for the application.
@@ -436,57 +2083,234 @@ func (a *App) Schema() string {
 // NewApp creates a new App instance from a struct configuration.
 // v must be a pointer to a struct that defines the CLI commands and flags using tags.
 // It automatically detects the executable name from the OS arguments or the executable path.
-func NewApp(v interface{}) (*App, error) {
+func NewApp(v interface{}, opts ...Option) (*App, error) {
+	a := &App{
+		lookupEnv: os.LookupEnv,
+		stdout:    os.Stdout,
+		stderr:    os.Stderr,
+		exit:      os.Exit,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+
 	rv := reflect.ValueOf(v)
-	exe, err := os.Executable()
-	if err != nil {
-		if len(os.Args) > 0 {
-			exe = os.Args[0]
-		} else {
-			exe = "unknown"
+	name := a.name
+	if name == "" {
+		exe, err := os.Executable()
+		if err != nil {
+			if len(os.Args) > 0 {
+				exe = os.Args[0]
+			} else {
+				exe = "unknown"
+			}
 		}
+		exe = strings.TrimSuffix(exe, ".exe")
+		name = filepath.Base(exe)
 	}
-	exe = strings.TrimSuffix(exe, ".exe")
-	exe = filepath.Base(exe)
-	cmd, err := buildCommand(rv.Type(), nil, exe)
+	cmd, err := buildCommand(rv.Type(), nil, name)
 	if err != nil {
 		return nil, err
 	}
+	cmd.deriveEnvNames()
+	cmd.setPathLookup(a.lookupEnv)
 	cmd.init()
-	return &App{c: cmd}, nil
+	a.c = cmd
+	if a.configDiscovery {
+		a.configSearch = a.configSearchPath()
+	}
+	if a.configHelp {
+		paths := a.configSearch
+		if a.configFile != "" {
+			paths = []string{a.configFile}
+		}
+		cmd.addConfigHelp(paths)
+	}
+	if len(a.dotEnvPaths) > 0 {
+		a.dotEnv, err = loadDotEnv(a.dotEnvPaths, a.lookupEnv)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
 }
 
 // Bind parses the provided arguments and sets the values in the destination struct dst.
 // It returns the remaining arguments that were not parsed as flags, the App instance, and any error encountered.
 func (a *App) Bind(dst interface{}, args []string) ([]string, App, error) {
-	ra, cmd, err := bindCommand(a.c, args, reflect.ValueOf(dst))
+	ra, cmd, err := a.bindCommand(a.c, args, reflect.ValueOf(dst))
 	if err != nil {
-		return args, App{c: cmd}, err
+		a.setExitCode(err)
+	}
+	errs, collected := err.(Errors)
+	if err != nil && !collected {
+		return args, a.sub(cmd), err
 	}
-	return ra, App{c: cmd}, nil
+	if verr := validateCommandPath(cmd, reflect.ValueOf(dst)); verr != nil {
+		a.setExitCode(verr)
+		if !a.allErrors {
+			return args, a.sub(cmd), verr
+		}
+		errs = append(errs, verr)
+	}
+	if len(errs) > 0 {
+		return args, a.sub(cmd), errs
+	}
+	if err := createPaths(cmd, reflect.ValueOf(dst)); err != nil {
+		return args, a.sub(cmd), err
+	}
+	return ra, a.sub(cmd), nil
+}
+
+// setExitCode applies the usage exit status of the App to the binding errors in err.
+func (a *App) setExitCode(err error) {
+	if a.usageExitCode == 0 {
+		return
+	}
+	if errs, ok := err.(Errors); ok {
+		for i := range errs {
+			a.setExitCode(errs[i])
+		}
+		return
+	}
+	if e, ok := err.(*Error); ok {
+		e.exitCode = a.usageExitCode
+	}
+}
+
+// Validator is implemented by command structs that check their own values,
+// e.g. rules spanning several flags.
+// Validate is called after binding for every command on the path from the root to the selected command.
+type Validator interface {
+	Validate() error
+}
+
+// validateCommandPath calls Validate on the command structs from the root of dst down to leaf.
+// Errors are wrapped with the path of the command that reported them.
+func validateCommandPath(leaf *command, dst reflect.Value) error {
+	var path []*command
+	for c := leaf; c != nil; c = c.Parent {
+		path = append([]*command{c}, path...)
+	}
+
+	var names []string
+	for i, c := range path {
+		if i > 0 {
+			dst = dst.Field(c.Index)
+		}
+		for dst.Kind() == reflect.Pointer {
+			if dst.IsNil() {
+				return nil
+			}
+			dst = dst.Elem()
+		}
+		names = append(names, c.Command)
+
+		if !dst.CanAddr() {
+			continue
+		}
+		if v, ok := dst.Addr().Interface().(Validator); ok {
+			if err := v.Validate(); err != nil {
+				return &Error{
+					Kind:    KindValidation,
+					Command: strings.Join(names, " "),
+					Err:     err,
+					msg:     strings.Join(names, " ") + ": " + err.Error(),
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// createPaths creates the directories of the flags of leaf with path:"dir,create", and the parent directories of
+// those with path:"file,create". It runs once binding and validation succeeded, so failed runs leave no trace.
+func createPaths(leaf *command, dst reflect.Value) error {
+	var path []*command
+	for c := leaf; c != nil; c = c.Parent {
+		path = append([]*command{c}, path...)
+	}
+	for i, c := range path {
+		if i > 0 {
+			dst = dst.Field(c.Index)
+		}
+		for dst.Kind() == reflect.Pointer {
+			if dst.IsNil() {
+				return nil
+			}
+			dst = dst.Elem()
+		}
+	}
+
+	for i := range leaf.Flags {
+		f := &leaf.Flags[i]
+		if f.path == nil || !f.path.create {
+			continue
+		}
+		for _, p := range pathValues(dst.Field(f.Index)) {
+			if p == "" {
+				continue
+			}
+			dir := p
+			if f.path.kind == "file" {
+				dir = filepath.Dir(p)
+			}
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return &Error{
+					Kind:    KindInvalidValue,
+					Command: leaf.path(),
+					Flag:    f.Name,
+					Value:   p,
+					Err:     err,
+					msg:     fmt.Sprintf("can not create directory %s for --%s: %v", strconv.Quote(dir), f.Name, err),
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// pathValues returns the strings held by v, a string or a list of strings, possibly behind pointers.
+func pathValues(v reflect.Value) []string {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return []string{v.String()}
+	case reflect.Slice, reflect.Array:
+		var values []string
+		for i := 0; i < v.Len(); i++ {
+			values = append(values, pathValues(v.Index(i))...)
+		}
+		return values
+	}
+	return nil
 }
 
 // Bind creates a new App and binds the provided arguments to the destination struct dst.
 // This is a shorthand for NewApp(dst) followed by a.Bind(dst, args).
-func Bind(dst interface{}, args []string) ([]string, App, error) {
-	a, err := NewApp(dst)
+func Bind(dst interface{}, args []string, opts ...Option) ([]string, App, error) {
+	a, err := NewApp(dst, opts...)
 	if err != nil {
 		return args, App{}, err
 	}
 	return a.Bind(dst, args)
 }
 
-// BindOSArgs binds the command-line arguments (os.Args) to the destination struct dst.
-// It automatically handles "--help" and version printing, exiting the program if necessary.
-// If an error occurs during binding (e.g., missing required flags), it prints the error and help message to stderr and exits with status 1.
-// It returns the remaining non-flag arguments.
-func BindOSArgs(dst interface{}) []string {
-	a, err := NewApp(dst)
-	if err != nil {
-		panic(err)
+// Run binds the arguments of the App (os.Args[1:] unless set with WithArgs) to the destination struct dst
+// like BindOSArgs, but returns instead of exiting.
+// On "--help" it prints the help message to the output and returns ErrHelp. On other errors it prints the
+// error and the help message to the error output and returns the error. It returns the remaining non-flag arguments.
+func (a *App) Run(dst interface{}) ([]string, error) {
+	args := a.args
+	if !a.hasArgs {
+		args = os.Args[1:]
 	}
-	a.c.init()
-	ra, app, err := a.Bind(dst, os.Args[1:])
+	ra, app, err := a.Bind(dst, args)
 	if err != nil {
 		if err == ErrHelp {
 			var sb strings.Builder
@@ -517,14 +2341,39 @@ func BindOSArgs(dst interface{}) []string {
 			// Write Usage
 			sb.WriteRune('\n')
 			sb.WriteString(app.Help())
-			fmt.Print(sb.String())
-			os.Exit(0)
+			fmt.Fprint(a.stdout, sb.String())
+			return ra, err
 		}
 
-		fmt.Fprintln(os.Stderr, err.Error())
-		fmt.Fprintln(os.Stderr)
-		fmt.Fprintln(os.Stderr, app.Help())
-		os.Exit(1)
+		if errs, ok := err.(Errors); ok {
+			for i := range errs {
+				fmt.Fprintln(a.stderr, "- "+errs[i].Error())
+			}
+		} else {
+			fmt.Fprintln(a.stderr, err.Error())
+		}
+		fmt.Fprintln(a.stderr)
+		fmt.Fprintln(a.stderr, app.Help())
+		return ra, err
+	}
+	return ra, nil
+}
+
+// BindOSArgs binds the command-line arguments (os.Args) to the destination struct dst.
+// It automatically handles "--help" and version printing, exiting the program if necessary.
+// If an error occurs during binding (e.g., missing required flags), it prints the error and help message to stderr
+// and exits with the status ExitCode returns for it, 2 for usage errors unless changed with WithUsageExitCode.
+// Errors collected with WithAllErrors are printed as a list, one error per line.
+// The arguments, outputs and exit function can be replaced with options; see Run for a variant that does not exit.
+// It returns the remaining non-flag arguments.
+func BindOSArgs(dst interface{}, opts ...Option) []string {
+	a, err := NewApp(dst, opts...)
+	if err != nil {
+		panic(err)
+	}
+	ra, err := a.Run(dst)
+	if err != nil {
+		a.exit(ExitCode(err))
 	}
 	return ra
 }
@@ -569,6 +2418,12 @@ func (a *command) init() {
 					sb.WriteRune('>')
 				}
 			}
+			for i := range a.Groups {
+				if a.Groups[i].Kind == "xor" {
+					sb.WriteRune(' ')
+					sb.WriteString(a.Groups[i].usage())
+				}
+			}
 		}
 		sb.WriteString(" [ARGUMENTS]\n\n")
 
@@ -615,10 +2470,34 @@ func (a *command) init() {
 					sb.WriteString(*a.Flags[i].Default)
 					sb.WriteRune(']')
 				}
-				if a.Flags[i].Env != nil {
+				if len(a.Flags[i].Env) > 0 {
 					sb.WriteRune(' ')
 					sb.WriteString("[env: ")
-					sb.WriteString(*a.Flags[i].Env)
+					sb.WriteString(strings.Join(a.Flags[i].Env, ", "))
+					sb.WriteRune(']')
+				}
+				if a.Flags[i].Encoding != nil {
+					sb.WriteRune(' ')
+					sb.WriteString("[encoding: ")
+					sb.WriteString(*a.Flags[i].Encoding)
+					sb.WriteRune(']')
+				}
+				if a.Flags[i].Min != nil || a.Flags[i].Max != nil {
+					sb.WriteRune(' ')
+					sb.WriteString("[range: ")
+					sb.WriteString(rangeString(a.Flags[i].Min, a.Flags[i].Max))
+					sb.WriteRune(']')
+				}
+				if a.Flags[i].MinLen != nil || a.Flags[i].MaxLen != nil {
+					sb.WriteRune(' ')
+					sb.WriteString("[length: ")
+					sb.WriteString(rangeString(optionalItoa(a.Flags[i].MinLen), optionalItoa(a.Flags[i].MaxLen)))
+					sb.WriteRune(']')
+				}
+				if len(a.Flags[i].Choices) > 0 {
+					sb.WriteRune(' ')
+					sb.WriteString("[possible values: ")
+					sb.WriteString(strings.Join(a.Flags[i].Choices, ", "))
 					sb.WriteRune(']')
 				}
 				if a.Flags[i].Required {
@@ -1,10 +1,17 @@
 package broccoli
 
 import (
+	"errors"
+	"fmt"
 	"math"
+	"math/big"
+	"net/netip"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestBindArgs(t *testing.T) {
@@ -369,3 +376,2426 @@ func TestEnvMatches(t *testing.T) {
 		}
 	})
 }
+
+func TestByteEncodings(t *testing.T) {
+	type BytesApp struct {
+		_     struct{} `version:"1.0.0" command:"BytesApp"`
+		Key   []byte   `flag:"key" encoding:"hex"`
+		Salt  []byte   `flag:"salt" encoding:"base64"`
+		Token []byte   `flag:"token" encoding:"base64url"`
+		Raw   []byte   `flag:"raw" encoding:"raw"`
+		List  []byte   `flag:"list"`
+	}
+
+	t.Run("test-decode", func(t *testing.T) {
+		var app BytesApp
+		_, _, err := Bind(&app, []string{
+			"--key", "deadbeef",
+			"--salt", "aGVsbG8=",
+			"--token", "_-8",
+			"--raw", "a,b",
+			"--list", "1,2,3",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(app.Key, []byte{0xde, 0xad, 0xbe, 0xef}) {
+			t.Errorf("unexpected key %v", app.Key)
+		}
+		if string(app.Salt) != "hello" {
+			t.Errorf("expected salt to be 'hello', got %q", app.Salt)
+		}
+		if !reflect.DeepEqual(app.Token, []byte{0xff, 0xef}) {
+			t.Errorf("unexpected token %v", app.Token)
+		}
+		if string(app.Raw) != "a,b" {
+			t.Errorf("expected raw to be 'a,b', got %q", app.Raw)
+		}
+		if !reflect.DeepEqual(app.List, []byte{1, 2, 3}) {
+			t.Errorf("unexpected list %v", app.List)
+		}
+	})
+
+	t.Run("test-decode-errors", func(t *testing.T) {
+		var app BytesApp
+		_, _, err := Bind(&app, []string{"--key", "abc"})
+		if !errors.Is(err, errOddHexLength) {
+			t.Errorf("expected errOddHexLength, got %v", err)
+		}
+		_, _, err = Bind(&app, []string{"--salt", "aGVsbG8"})
+		if !errors.Is(err, errBadPadding) {
+			t.Errorf("expected errBadPadding, got %v", err)
+		}
+		_, _, err = Bind(&app, []string{"--token", "a"})
+		if !errors.Is(err, errBadPadding) {
+			t.Errorf("expected errBadPadding, got %v", err)
+		}
+	})
+
+	t.Run("test-help-and-schema", func(t *testing.T) {
+		a, err := NewApp(&BytesApp{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(a.Help(), "[encoding: hex]") {
+			t.Errorf("expected help to contain encoding, got\n%s", a.Help())
+		}
+		if !strings.Contains(a.Schema(), `"encoding":"base64url"`) {
+			t.Errorf("expected schema to contain encoding, got %s", a.Schema())
+		}
+	})
+
+	t.Run("test-invalid-encoding", func(t *testing.T) {
+		type InvalidApp struct {
+			Key []byte `flag:"key" encoding:"base32"`
+		}
+		if _, err := NewApp(&InvalidApp{}); err == nil {
+			t.Error("expected error for unknown encoding")
+		}
+	})
+}
+
+func TestArraysAndCustomElements(t *testing.T) {
+	type CustomApp struct {
+		_        struct{}         `version:"1.0.0" command:"CustomApp"`
+		RGB      [3]uint8         `flag:"rgb"`
+		Timeout  time.Duration    `flag:"timeout" default:"1m"`
+		Backoff  []time.Duration  `flag:"backoff"`
+		Prefixes []netip.Prefix   `flag:"prefixes"`
+		Addr     *netip.Addr      `flag:"addr"`
+		Pairs    [2]time.Duration `flag:"pairs"`
+	}
+
+	t.Run("test-values", func(t *testing.T) {
+		var app CustomApp
+		_, _, err := Bind(&app, []string{
+			"--rgb", "255,0,128",
+			"--backoff", "1s,2s,500ms",
+			"--prefixes", "10.0.0.0/8,fd00::/8",
+			"--addr", "127.0.0.1",
+			"--pairs", "1h,2h",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if app.RGB != [3]uint8{255, 0, 128} {
+			t.Errorf("unexpected rgb %v", app.RGB)
+		}
+		if app.Timeout != time.Minute {
+			t.Errorf("expected timeout to be 1m, got %v", app.Timeout)
+		}
+		if !reflect.DeepEqual(app.Backoff, []time.Duration{time.Second, 2 * time.Second, 500 * time.Millisecond}) {
+			t.Errorf("unexpected backoff %v", app.Backoff)
+		}
+		expectedPrefixes := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("fd00::/8")}
+		if !reflect.DeepEqual(app.Prefixes, expectedPrefixes) {
+			t.Errorf("unexpected prefixes %v", app.Prefixes)
+		}
+		if app.Addr == nil || *app.Addr != netip.MustParseAddr("127.0.0.1") {
+			t.Errorf("unexpected addr %v", app.Addr)
+		}
+		if app.Pairs != [2]time.Duration{time.Hour, 2 * time.Hour} {
+			t.Errorf("unexpected pairs %v", app.Pairs)
+		}
+	})
+
+	t.Run("test-wrong-length", func(t *testing.T) {
+		var app CustomApp
+		_, _, err := Bind(&app, []string{"--rgb", "255,0"})
+		if !errors.Is(err, errWrongLength) {
+			t.Errorf("expected errWrongLength, got %v", err)
+		}
+	})
+
+	t.Run("test-element-overflow", func(t *testing.T) {
+		var app CustomApp
+		_, _, err := Bind(&app, []string{"--rgb", "300,0,128"})
+		if !errors.Is(err, ErrTypeMismatch) {
+			t.Errorf("expected ErrTypeMismatch for 300 as uint8, got %v (rgb %v)", err, app.RGB)
+		}
+	})
+
+	t.Run("test-invalid-element", func(t *testing.T) {
+		var app CustomApp
+		_, _, err := Bind(&app, []string{"--prefixes", "10.0.0.0/8,nope"})
+		if err == nil {
+			t.Error("expected error for invalid prefix")
+		}
+	})
+
+	t.Run("test-register-parser", func(t *testing.T) {
+		type Level int
+		RegisterParser(reflect.TypeOf(Level(0)), func(s string) (interface{}, error) {
+			switch s {
+			case "low":
+				return Level(1), nil
+			case "high":
+				return Level(2), nil
+			}
+			return nil, errors.New("unknown level")
+		})
+		type LevelApp struct {
+			Levels []Level `flag:"levels"`
+		}
+		var app LevelApp
+		_, _, err := Bind(&app, []string{"--levels", "high,low"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(app.Levels, []Level{2, 1}) {
+			t.Errorf("unexpected levels %v", app.Levels)
+		}
+	})
+
+	t.Run("test-misbehaving-parser", func(t *testing.T) {
+		type Mode int
+		RegisterParser(reflect.TypeOf(Mode(0)), func(s string) (interface{}, error) {
+			if s == "nil" {
+				return nil, nil
+			}
+			return "not a mode", nil
+		})
+		type ModeApp struct {
+			Mode Mode `flag:"mode"`
+		}
+		for _, tc := range []struct {
+			value string
+			msg   string
+		}{
+			{"nil", `invalid value "nil" for --mode (from argument): the parser registered for broccoli.Mode returned nil`},
+			{"x", `invalid value "x" for --mode (from argument): the parser registered for broccoli.Mode returned string`},
+		} {
+			var app ModeApp
+			_, _, err := Bind(&app, []string{"--mode", tc.value})
+			var e *Error
+			if !errors.As(err, &e) || e.Kind != KindInvalidValue || err.Error() != tc.msg {
+				t.Errorf("expected %s, got %v", tc.msg, err)
+			}
+		}
+	})
+}
+
+func TestBigAndComplexNumbers(t *testing.T) {
+	type NumbersApp struct {
+		_      struct{}   `version:"1.0.0" command:"NumbersApp"`
+		Int    *big.Int   `flag:"int"`
+		Float  *big.Float `flag:"float"`
+		Rat    *big.Rat   `flag:"rat"`
+		C64    complex64  `flag:"c64"`
+		C128   complex128 `flag:"c128" default:"1+2i"`
+		Signed int        `flag:"signed"`
+	}
+
+	t.Run("test-values", func(t *testing.T) {
+		var app NumbersApp
+		_, _, err := Bind(&app, []string{
+			"--int", "-0xffffffffffffffffffff",
+			"--float", "1.5e100",
+			"--rat", "0x10/0b11",
+			"--c64", "3-4i",
+			"--signed", "-0x10",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectedInt, _ := new(big.Int).SetString("-ffffffffffffffffffff", 16)
+		if app.Int.Cmp(expectedInt) != 0 {
+			t.Errorf("expected int to be %v, got %v", expectedInt, app.Int)
+		}
+		expectedFloat, _ := new(big.Float).SetString("1.5e100")
+		if app.Float.Cmp(expectedFloat) != 0 {
+			t.Errorf("expected float to be %v, got %v", expectedFloat, app.Float)
+		}
+		if app.Rat.Cmp(big.NewRat(16, 3)) != 0 {
+			t.Errorf("expected rat to be 16/3, got %v", app.Rat)
+		}
+		if app.C64 != complex(3, -4) {
+			t.Errorf("expected c64 to be (3-4i), got %v", app.C64)
+		}
+		if app.C128 != complex(1, 2) {
+			t.Errorf("expected c128 to be (1+2i), got %v", app.C128)
+		}
+		if app.Signed != -16 {
+			t.Errorf("expected signed to be -16, got %d", app.Signed)
+		}
+	})
+
+	t.Run("test-float-precision", func(t *testing.T) {
+		const value = "1234567890.123456789012345678"
+		var app NumbersApp
+		if _, _, err := Bind(&app, []string{"--float", value}); err != nil {
+			t.Fatal(err)
+		}
+		if s := app.Float.Text('f', 18); s != value {
+			t.Errorf("expected %s, got %s", value, s)
+		}
+	})
+
+	t.Run("test-invalid", func(t *testing.T) {
+		for _, args := range [][]string{
+			{"--int", "0xzz"},
+			{"--float", "abc"},
+			{"--rat", "1/0"},
+			{"--c64", "1+"},
+		} {
+			var app NumbersApp
+			if _, _, err := Bind(&app, args); err == nil {
+				t.Errorf("expected error for %v", args)
+			}
+		}
+	})
+}
+
+func TestChoices(t *testing.T) {
+	type ChoicesApp struct {
+		_      struct{} `version:"1.0.0" command:"ChoicesApp"`
+		Format string   `flag:"format" choices:"json,yaml,table" default:"table" env:"BROCCOLI_FORMAT"`
+		Level  int      `flag:"level" choices:"1, 2, 3"`
+		Tags   []string `flag:"tags" choices:"a,b,c"`
+	}
+
+	t.Run("test-valid", func(t *testing.T) {
+		var app ChoicesApp
+		_, _, err := Bind(&app, []string{"--level", "2", "--tags", "a,c"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if app.Format != "table" || app.Level != 2 || !reflect.DeepEqual(app.Tags, []string{"a", "c"}) {
+			t.Errorf("unexpected values %+v", app)
+		}
+	})
+
+	t.Run("test-invalid-arg", func(t *testing.T) {
+		var app ChoicesApp
+		_, _, err := Bind(&app, []string{"--format", "xml"})
+		if !errors.Is(err, errInvalidChoice) {
+			t.Fatalf("expected errInvalidChoice, got %v", err)
+		}
+		if !strings.HasSuffix(err.Error(), ": not one of the possible values (json, yaml, table)") {
+			t.Errorf("expected error to list the possible values, got %v", err)
+		}
+		_, _, err = Bind(&app, []string{"--tags", "a,d"})
+		if !errors.Is(err, errInvalidChoice) {
+			t.Errorf("expected errInvalidChoice, got %v", err)
+		}
+	})
+
+	t.Run("test-invalid-env", func(t *testing.T) {
+		t.Setenv("BROCCOLI_FORMAT", "csv")
+		var app ChoicesApp
+		_, _, err := Bind(&app, []string{})
+		if !errors.Is(err, errInvalidChoice) {
+			t.Errorf("expected errInvalidChoice, got %v", err)
+		}
+	})
+
+	t.Run("test-invalid-default", func(t *testing.T) {
+		type DefaultApp struct {
+			Format string `flag:"format" choices:"json,yaml" default:"xml"`
+		}
+		var app DefaultApp
+		_, _, err := Bind(&app, []string{})
+		if !errors.Is(err, errInvalidChoice) {
+			t.Errorf("expected errInvalidChoice, got %v", err)
+		}
+	})
+
+	t.Run("test-help-and-schema", func(t *testing.T) {
+		a, err := NewApp(&ChoicesApp{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(a.Help(), "[possible values: json, yaml, table]") {
+			t.Errorf("expected help to contain possible values, got\n%s", a.Help())
+		}
+		if !strings.Contains(a.Schema(), `"choices":["json","yaml","table"]`) {
+			t.Errorf("expected schema to contain choices, got %s", a.Schema())
+		}
+	})
+
+	t.Run("test-unparsable-choice", func(t *testing.T) {
+		type InvalidApp struct {
+			Level int `flag:"level" choices:"1,two"`
+		}
+		if _, err := NewApp(&InvalidApp{}); err == nil {
+			t.Error("expected error for unparsable choice")
+		}
+	})
+
+	t.Run("test-pointer-elements", func(t *testing.T) {
+		type PointerApp struct {
+			F []*string `flag:"f" choices:"a,b"`
+		}
+		var app PointerApp
+		if _, _, err := Bind(&app, []string{"--f", "a,b"}); err != nil {
+			t.Fatal(err)
+		}
+		if len(app.F) != 2 || *app.F[0] != "a" || *app.F[1] != "b" {
+			t.Errorf("unexpected values %v", app.F)
+		}
+		app = PointerApp{}
+		if _, _, err := Bind(&app, []string{"--f", "a,c"}); !errors.Is(err, errInvalidChoice) {
+			t.Errorf("expected errInvalidChoice, got %v", err)
+		}
+	})
+
+	t.Run("test-bool-choices", func(t *testing.T) {
+		type InvalidApp struct {
+			Verbose bool `flag:"verbose" choices:"true"`
+		}
+		_, err := NewApp(&InvalidApp{})
+		var de *DefinitionError
+		if !errors.As(err, &de) || !reflect.DeepEqual(de.Problems, []string{"broccoli.InvalidApp.Verbose: choices is not supported on bool flags"}) {
+			t.Errorf("expected a definition error for choices on a bool flag, got %v", err)
+		}
+	})
+}
+
+func TestQuotedLists(t *testing.T) {
+	type ListApp struct {
+		_      struct{} `version:"1.0.0" command:"ListApp"`
+		Hosts  []string `flag:"hosts" env:"BROCCOLI_HOSTS"`
+		Legacy []string `flag:"legacy" csv:"false" default:"\"a,b\""`
+		Names  []string `flag:"names" default:"\"Doe, John\",\"say \"\"hi\"\"\""`
+	}
+
+	t.Run("test-quoted-arg", func(t *testing.T) {
+		var app ListApp
+		_, _, err := Bind(&app, []string{"--hosts", `"a,b",c,,"d"`})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(app.Hosts, []string{"a,b", "c", "", "d"}) {
+			t.Errorf("unexpected hosts %q", app.Hosts)
+		}
+		if !reflect.DeepEqual(app.Legacy, []string{`"a`, `b"`}) {
+			t.Errorf("unexpected legacy %q", app.Legacy)
+		}
+		if !reflect.DeepEqual(app.Names, []string{"Doe, John", `say "hi"`}) {
+			t.Errorf("unexpected names %q", app.Names)
+		}
+	})
+
+	t.Run("test-quoted-env", func(t *testing.T) {
+		t.Setenv("BROCCOLI_HOSTS", `x,"y,z"`)
+		var app ListApp
+		_, _, err := Bind(&app, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(app.Hosts, []string{"x", "y,z"}) {
+			t.Errorf("unexpected hosts %q", app.Hosts)
+		}
+	})
+
+	t.Run("test-invalid-quotes", func(t *testing.T) {
+		var app ListApp
+		_, _, err := Bind(&app, []string{"--hosts", `"a,b`})
+		if !errors.Is(err, errUnterminatedQuote) {
+			t.Errorf("expected errUnterminatedQuote, got %v", err)
+		}
+		_, _, err = Bind(&app, []string{"--hosts", `"a"b,c`})
+		if !errors.Is(err, errBareQuote) {
+			t.Errorf("expected errBareQuote, got %v", err)
+		}
+	})
+}
+
+func TestRangeConstraints(t *testing.T) {
+	type RangeApp struct {
+		_       struct{} `version:"1.0.0" command:"RangeApp"`
+		Port    int      `flag:"port" min:"1" max:"65535" env:"BROCCOLI_RANGE_PORT" default:"8080"`
+		Ratio   float64  `flag:"ratio" min:"0" max:"1"`
+		Weights []uint   `flag:"weights" max:"10"`
+		Name    string   `flag:"name" min_len:"2" max_len:"5"`
+		Tags    []string `flag:"tags" min_len:"1"`
+	}
+
+	t.Run("test-valid", func(t *testing.T) {
+		var app RangeApp
+		_, _, err := Bind(&app, []string{"--ratio", "0.5", "--weights", "1,10", "--name", "한글", "--tags", "a"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if app.Port != 8080 {
+			t.Errorf("expected port to be 8080, got %d", app.Port)
+		}
+	})
+
+	t.Run("test-out-of-range", func(t *testing.T) {
+		for _, args := range [][]string{
+			{"--port", "0"},
+			{"--port", "65536"},
+			{"--ratio", "1.5"},
+			{"--ratio", "NaN"},
+			{"--weights", "1,11"},
+		} {
+			var app RangeApp
+			_, _, err := Bind(&app, args)
+			if !errors.Is(err, errOutOfRange) {
+				t.Errorf("expected errOutOfRange for %v, got %v", args, err)
+			}
+		}
+	})
+
+	t.Run("test-overflow", func(t *testing.T) {
+		type SmallApp struct {
+			P int8    `flag:"p" max:"100"`
+			F float32 `flag:"f"`
+		}
+		for _, args := range [][]string{
+			{"--p", "200"},
+			{"--p", "-129"},
+			{"--f", "1e39"},
+		} {
+			var app SmallApp
+			_, _, err := Bind(&app, args)
+			if !errors.Is(err, ErrTypeMismatch) {
+				t.Errorf("expected ErrTypeMismatch for %v, got %v (%+v)", args, err, app)
+			}
+		}
+		var app SmallApp
+		_, _, err := Bind(&app, []string{"--p", "101"})
+		if !errors.Is(err, errOutOfRange) {
+			t.Errorf("expected errOutOfRange, got %v", err)
+		}
+	})
+
+	t.Run("test-pointer-elements", func(t *testing.T) {
+		type PointerApp struct {
+			Ports []*int `flag:"ports" min:"1" max:"100"`
+		}
+		var app PointerApp
+		if _, _, err := Bind(&app, []string{"--ports", "1,100"}); err != nil {
+			t.Fatal(err)
+		}
+		if len(app.Ports) != 2 || *app.Ports[0] != 1 || *app.Ports[1] != 100 {
+			t.Errorf("unexpected ports %v", app.Ports)
+		}
+		app = PointerApp{}
+		_, _, err := Bind(&app, []string{"--ports", "1,101"})
+		if !errors.Is(err, errOutOfRange) {
+			t.Errorf("expected errOutOfRange, got %v", err)
+		}
+	})
+
+	t.Run("test-invalid-length", func(t *testing.T) {
+		for _, args := range [][]string{
+			{"--name", "a"},
+			{"--name", "abcdef"},
+		} {
+			var app RangeApp
+			_, _, err := Bind(&app, args)
+			if !errors.Is(err, errInvalidLength) {
+				t.Errorf("expected errInvalidLength for %v, got %v", args, err)
+			}
+		}
+	})
+
+	t.Run("test-error-names-source", func(t *testing.T) {
+		t.Setenv("BROCCOLI_RANGE_PORT", "70000")
+		var app RangeApp
+		_, _, err := Bind(&app, []string{})
+		if !errors.Is(err, errOutOfRange) {
+			t.Fatalf("expected errOutOfRange, got %v", err)
+		}
+		if !strings.Contains(err.Error(), "--port") || !strings.Contains(err.Error(), "env BROCCOLI_RANGE_PORT") {
+			t.Errorf("expected error to name the flag and the source, got %v", err)
+		}
+	})
+
+	t.Run("test-help", func(t *testing.T) {
+		a, err := NewApp(&RangeApp{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range []string{"[range: 1..65535]", "[range: ..10]", "[length: 2..5]", "[length: 1..]"} {
+			if !strings.Contains(a.Help(), s) {
+				t.Errorf("expected help to contain %s, got\n%s", s, a.Help())
+			}
+		}
+	})
+
+	t.Run("test-invalid-definition", func(t *testing.T) {
+		type InvalidApp struct {
+			Name string `flag:"name" min:"1"`
+		}
+		if _, err := NewApp(&InvalidApp{}); err == nil {
+			t.Error("expected error for min on a string flag")
+		}
+	})
+}
+
+func TestPattern(t *testing.T) {
+	type PatternApp struct {
+		_       struct{} `version:"1.0.0" command:"PatternApp"`
+		Name    string   `flag:"name" pattern:"[a-z][a-z0-9-]*" pattern_msg:"must be a lowercase identifier" default:"web-1"`
+		Regions []string `flag:"regions" pattern:"[a-z]{2}-[a-z]+-[0-9]"`
+	}
+
+	t.Run("test-valid", func(t *testing.T) {
+		var app PatternApp
+		_, _, err := Bind(&app, []string{"--regions", "us-east-1,eu-west-2"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if app.Name != "web-1" {
+			t.Errorf("expected name to be 'web-1', got '%s'", app.Name)
+		}
+	})
+
+	t.Run("test-full-match", func(t *testing.T) {
+		var app PatternApp
+		_, _, err := Bind(&app, []string{"--name", "Web-1"})
+		if !errors.Is(err, errPatternMismatch) {
+			t.Fatalf("expected errPatternMismatch, got %v", err)
+		}
+		if !strings.Contains(err.Error(), "must be a lowercase identifier") {
+			t.Errorf("expected error to contain pattern_msg, got %v", err)
+		}
+		_, _, err = Bind(&app, []string{"--regions", "us-east-1,us-east-1x"})
+		if !errors.Is(err, errPatternMismatch) {
+			t.Errorf("expected errPatternMismatch, got %v", err)
+		}
+	})
+
+	t.Run("test-pointer-elements", func(t *testing.T) {
+		type PointerApp struct {
+			Regions []*string `flag:"regions" pattern:"[a-z]{2}-[a-z]+-[0-9]"`
+		}
+		var app PointerApp
+		if _, _, err := Bind(&app, []string{"--regions", "us-east-1,eu-west-2"}); err != nil {
+			t.Fatal(err)
+		}
+		if len(app.Regions) != 2 || *app.Regions[1] != "eu-west-2" {
+			t.Errorf("unexpected regions %v", app.Regions)
+		}
+		app = PointerApp{}
+		_, _, err := Bind(&app, []string{"--regions", "us-east-1,US-east-1"})
+		if !errors.Is(err, errPatternMismatch) {
+			t.Errorf("expected errPatternMismatch, got %v", err)
+		}
+	})
+
+	t.Run("test-invalid-pattern", func(t *testing.T) {
+		type InvalidApp struct {
+			Name string `flag:"name" pattern:"[a-z"`
+		}
+		if _, err := NewApp(&InvalidApp{}); err == nil {
+			t.Error("expected error for invalid pattern")
+		}
+	})
+}
+
+type validatorServe struct {
+	_       struct{} `command:"serve"`
+	TLSCert string   `flag:"tls-cert"`
+	TLSKey  string   `flag:"tls-key"`
+}
+
+func (s *validatorServe) Validate() error {
+	if s.TLSCert != "" && s.TLSKey == "" {
+		return errors.New("--tls-cert needs --tls-key")
+	}
+	return nil
+}
+
+type validatorApp struct {
+	_       struct{}        `command:"app"`
+	Verbose bool            `flag:"verbose"`
+	Serve   *validatorServe `subcommand:"serve"`
+
+	calls *[]string
+}
+
+func (a validatorApp) Validate() error {
+	if a.calls != nil {
+		*a.calls = append(*a.calls, "app")
+	}
+	return nil
+}
+
+func TestValidator(t *testing.T) {
+	t.Run("test-valid", func(t *testing.T) {
+		var calls []string
+		app := validatorApp{calls: &calls}
+		_, _, err := Bind(&app, []string{"serve", "--tls-cert", "a.pem", "--tls-key", "a.key"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(calls, []string{"app"}) {
+			t.Errorf("expected root Validate to be called once, got %v", calls)
+		}
+	})
+
+	t.Run("test-invalid", func(t *testing.T) {
+		var app validatorApp
+		_, sub, err := Bind(&app, []string{"serve", "--tls-cert", "a.pem"})
+		if err == nil {
+			t.Fatal("expected validation error")
+		}
+		if err.Error() != "app serve: --tls-cert needs --tls-key" {
+			t.Errorf("unexpected error %v", err)
+		}
+		if sub.c == nil || sub.c.Command != "serve" {
+			t.Errorf("expected the serve command to be returned")
+		}
+	})
+}
+
+func TestMutuallyExclusiveFlags(t *testing.T) {
+	type OutputApp struct {
+		_     struct{} `version:"1.0.0" command:"OutputApp"`
+		JSON  bool     `flag:"json" xor:"output" xor_required:"true"`
+		YAML  bool     `flag:"yaml" xor:"output" env:"BROCCOLI_YAML"`
+		Table bool     `flag:"table" xor:"output"`
+		Color string   `flag:"color" xor:"color"`
+		Plain bool     `flag:"plain" xor:"color"`
+	}
+
+	t.Run("test-one-set", func(t *testing.T) {
+		var app OutputApp
+		_, _, err := Bind(&app, []string{"--yaml", "--color", "red"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !app.YAML || app.Color != "red" {
+			t.Errorf("unexpected values %+v", app)
+		}
+	})
+
+	t.Run("test-conflict", func(t *testing.T) {
+		var app OutputApp
+		_, _, err := Bind(&app, []string{"--json", "--table"})
+		if !errors.Is(err, ErrConflict) {
+			t.Errorf("expected ErrConflict, got %v", err)
+		}
+	})
+
+	t.Run("test-conflict-env", func(t *testing.T) {
+		t.Setenv("BROCCOLI_YAML", "true")
+		var app OutputApp
+		_, _, err := Bind(&app, []string{"--json"})
+		if !errors.Is(err, ErrConflict) {
+			t.Fatalf("expected ErrConflict, got %v", err)
+		}
+		if !strings.Contains(err.Error(), "env BROCCOLI_YAML") {
+			t.Errorf("expected error to name the env source, got %v", err)
+		}
+	})
+
+	t.Run("test-required", func(t *testing.T) {
+		var app OutputApp
+		_, _, err := Bind(&app, []string{})
+		if !errors.Is(err, ErrMissingRequiredField) {
+			t.Errorf("expected ErrMissingRequiredField, got %v", err)
+		}
+	})
+
+	t.Run("test-help-and-schema", func(t *testing.T) {
+		a, err := NewApp(&OutputApp{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(a.Help(), "(--json | --yaml | --table) (--color | --plain)") {
+			t.Errorf("expected usage to contain the groups, got\n%s", a.Help())
+		}
+		if !strings.Contains(a.Schema(), `"groups":[{"name":"output","kind":"xor","flags":["json","yaml","table"],"required":true}`) {
+			t.Errorf("expected schema to contain the groups, got %s", a.Schema())
+		}
+	})
+
+	t.Run("test-default-member", func(t *testing.T) {
+		type DefaultApp struct {
+			JSON   bool   `flag:"json" xor:"out"`
+			Format string `flag:"format" xor:"out" default:"table"`
+			Token  string `flag:"token" at_least_one_of:"auth" default:"x"`
+		}
+		_, err := NewApp(&DefaultApp{})
+		var de *DefinitionError
+		expected := []string{
+			"broccoli.DefaultApp.Format: default can not be used with xor",
+			"broccoli.DefaultApp.Token: default can not be used with at_least_one_of",
+		}
+		if !errors.As(err, &de) || !reflect.DeepEqual(de.Problems, expected) {
+			t.Errorf("expected definition errors for defaults in groups, got %v", err)
+		}
+	})
+}
+
+func TestConditionalRequirements(t *testing.T) {
+	type ServerApp struct {
+		_       struct{} `version:"1.0.0" command:"ServerApp"`
+		Mode    string   `flag:"mode" env:"BROCCOLI_MODE" default:"local"`
+		Port    int      `flag:"port" required_if:"mode=server"`
+		TLSCert string   `flag:"tls-cert" requires:"tls-key"`
+		TLSKey  string   `flag:"tls-key"`
+		Config  string   `flag:"config"`
+		Token   string   `flag:"token" required_unless:"config,mode=local" at_least_one_of:"auth"`
+		User    string   `flag:"user" at_least_one_of:"auth"`
+	}
+
+	t.Run("test-satisfied", func(t *testing.T) {
+		var app ServerApp
+		_, _, err := Bind(&app, []string{"--mode", "server", "--port", "80", "--token", "t", "--tls-cert", "c", "--tls-key", "k"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("test-errors", func(t *testing.T) {
+		for _, tc := range []struct {
+			args []string
+			msg  string
+		}{
+			{[]string{"--mode", "server", "--token", "t"}, "--port is required because --mode=server"},
+			{[]string{"--tls-cert", "c", "--user", "u"}, "--tls-cert (from argument) requires --tls-key"},
+			{[]string{"--mode", "server", "--port", "80", "--user", "u"}, "--token is required unless --config is set or --mode=local"},
+			{[]string{}, "at least one of (--token | --user) is required"},
+		} {
+			var app ServerApp
+			_, _, err := Bind(&app, tc.args)
+			if !errors.Is(err, ErrMissingRequiredField) {
+				t.Errorf("expected ErrMissingRequiredField for %v, got %v", tc.args, err)
+				continue
+			}
+			if !strings.Contains(err.Error(), tc.msg) {
+				t.Errorf("expected error to contain %q, got %v", tc.msg, err)
+			}
+		}
+	})
+
+	t.Run("test-condition-from-env", func(t *testing.T) {
+		t.Setenv("BROCCOLI_MODE", "server")
+		var app ServerApp
+		_, _, err := Bind(&app, []string{"--user", "u", "--config", "c"})
+		if err == nil || !strings.Contains(err.Error(), "--port is required because --mode=server (from env BROCCOLI_MODE)") {
+			t.Errorf("unexpected error %v", err)
+		}
+	})
+
+	t.Run("test-unknown-flag", func(t *testing.T) {
+		type InvalidApp struct {
+			Cert string `flag:"cert" requires:"key"`
+		}
+		if _, err := NewApp(&InvalidApp{}); err == nil {
+			t.Error("expected error for unknown flag in requires")
+		}
+	})
+}
+
+func TestPathFlags(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	if err := os.WriteFile(filepath.Join(dir, "input.txt"), []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	type PathApp struct {
+		_      struct{} `version:"1.0.0" command:"PathApp"`
+		Input  string   `flag:"input" path:"file,exists"`
+		Output string   `flag:"output" path:"dir,create"`
+		Rel    string   `flag:"rel" path:"abs"`
+		Files  []string `flag:"files" path:"file,exists"`
+	}
+
+	t.Run("test-expand-and-create", func(t *testing.T) {
+		var app PathApp
+		_, _, err := Bind(&app, []string{
+			"--input", "~/input.txt",
+			"--output", "$HOME/out/nested",
+			"--rel", "some/file",
+			"--files", "${HOME}/input.txt,~/input.txt",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if app.Input != filepath.Join(dir, "input.txt") {
+			t.Errorf("unexpected input %s", app.Input)
+		}
+		if fi, err := os.Stat(filepath.Join(dir, "out", "nested")); err != nil || !fi.IsDir() {
+			t.Errorf("expected output directory to be created, got %v", err)
+		}
+		if !filepath.IsAbs(app.Rel) {
+			t.Errorf("expected rel to be absolute, got %s", app.Rel)
+		}
+		if len(app.Files) != 2 || app.Files[0] != app.Files[1] {
+			t.Errorf("unexpected files %v", app.Files)
+		}
+	})
+
+	t.Run("test-checks", func(t *testing.T) {
+		var app PathApp
+		_, _, err := Bind(&app, []string{"--input", "~/missing.txt"})
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected os.ErrNotExist, got %v", err)
+		} else if !strings.Contains(err.Error(), "--input") {
+			t.Errorf("expected error to name the flag, got %v", err)
+		}
+		_, _, err = Bind(&app, []string{"--input", "~"})
+		if !errors.Is(err, errNotAFile) {
+			t.Errorf("expected errNotAFile, got %v", err)
+		}
+		_, _, err = Bind(&app, []string{"--output", "~/input.txt"})
+		if !errors.Is(err, errNotADir) {
+			t.Errorf("expected errNotADir, got %v", err)
+		}
+	})
+
+	t.Run("test-create-after-binding", func(t *testing.T) {
+		type CreateApp struct {
+			Output string `flag:"output" path:"dir,create" default:"$HOME/default-out"`
+			Log    string `flag:"log" path:"file,create"`
+			Count  int    `flag:"count"`
+		}
+		var app CreateApp
+		_, _, err := Bind(&app, []string{"--output", "~/failed-out", "--count", "many"})
+		if err == nil {
+			t.Fatal("expected error for invalid count")
+		}
+		if _, err := os.Stat(filepath.Join(dir, "failed-out")); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected no directory for a failed run, got %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "default-out")); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected no directory for the default of a failed run, got %v", err)
+		}
+
+		app = CreateApp{}
+		if _, _, err := Bind(&app, []string{"--log", "~/logs/app.log"}); err != nil {
+			t.Fatal(err)
+		}
+		if fi, err := os.Stat(filepath.Join(dir, "logs")); err != nil || !fi.IsDir() {
+			t.Errorf("expected the parent directory of the log to be created, got %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "logs", "app.log")); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected the log file itself not to be created, got %v", err)
+		}
+	})
+
+	t.Run("test-injected-home", func(t *testing.T) {
+		home := t.TempDir()
+		env := WithLookupEnv(func(name string) (string, bool) {
+			if name == "HOME" {
+				return home, true
+			}
+			return "", false
+		})
+		var app PathApp
+		if _, _, err := Bind(&app, []string{"--rel", "~/x", "--output", "$HOME/out"}, env); err != nil {
+			t.Fatal(err)
+		}
+		if app.Rel != filepath.Join(home, "x") || app.Output != filepath.Join(home, "out") {
+			t.Errorf("expected paths in the injected home, got %s and %s", app.Rel, app.Output)
+		}
+
+		app = PathApp{}
+		noEnv := WithLookupEnv(func(string) (string, bool) { return "", false })
+		if _, _, err := Bind(&app, []string{"--rel", "~/x"}, noEnv); err == nil || !strings.Contains(err.Error(), "$HOME is not defined") {
+			t.Errorf("expected an error without HOME, got %v", err)
+		}
+	})
+
+	t.Run("test-invalid-options", func(t *testing.T) {
+		type InvalidApp struct {
+			Input string `flag:"input" path:"file,exist"`
+		}
+		if _, err := NewApp(&InvalidApp{}); err == nil {
+			t.Error("expected error for unknown path option")
+		}
+	})
+}
+
+func TestAllErrors(t *testing.T) {
+	type AllErrorsApp struct {
+		_      struct{} `version:"1.0.0" command:"AllErrorsApp"`
+		Port   int      `flag:"port" max:"65535"`
+		Count  int      `flag:"count"`
+		Name   string   `flag:"name" required:"true"`
+		Format string   `flag:"format" choices:"json,yaml" default:"xml"`
+	}
+
+	t.Run("test-collect", func(t *testing.T) {
+		var app AllErrorsApp
+		_, _, err := Bind(&app, []string{"--port", "70000", "--count", "many"}, WithAllErrors())
+		var errs Errors
+		if !errors.As(err, &errs) {
+			t.Fatalf("expected Errors, got %v", err)
+		}
+		if len(errs) != 4 {
+			t.Fatalf("expected 4 errors, got %d: %v", len(errs), errs)
+		}
+		if !errors.Is(errs[0], errOutOfRange) {
+			t.Errorf("expected errOutOfRange, got %v", errs[0])
+		}
+		if !errors.Is(errs[3], errInvalidChoice) {
+			t.Errorf("expected errInvalidChoice, got %v", errs[3])
+		}
+		if !errors.Is(err, errInvalidChoice) {
+			t.Errorf("expected Errors to match errInvalidChoice")
+		}
+	})
+
+	t.Run("test-validator", func(t *testing.T) {
+		var app validatorApp
+		_, _, err := Bind(&app, []string{"serve", "--tls-cert", "a.pem", "--unknown"}, WithAllErrors())
+		var errs Errors
+		if !errors.As(err, &errs) || len(errs) != 1 {
+			t.Fatalf("expected one collected error, got %v", err)
+		}
+	})
+
+	t.Run("test-first-error", func(t *testing.T) {
+		var app AllErrorsApp
+		_, _, err := Bind(&app, []string{"--port", "70000", "--count", "many"})
+		if _, ok := err.(Errors); ok {
+			t.Fatalf("expected a single error without WithAllErrors, got %v", err)
+		}
+		if !errors.Is(err, errOutOfRange) {
+			t.Errorf("expected errOutOfRange, got %v", err)
+		}
+	})
+}
+
+func TestTypedErrors(t *testing.T) {
+	type DBApp struct {
+		_    struct{} `command:"db"`
+		Port int      `flag:"port" env:"BROCCOLI_DB_PORT" max:"65535"`
+		Name string   `flag:"name" required:"true"`
+	}
+	type TypedApp struct {
+		_  struct{} `command:"app"`
+		DB *DBApp   `subcommand:"db"`
+	}
+
+	t.Run("test-missing-required", func(t *testing.T) {
+		var app TypedApp
+		_, _, err := Bind(&app, []string{"db"})
+		if !errors.Is(err, ErrMissingRequiredField) {
+			t.Fatalf("expected ErrMissingRequiredField, got %v", err)
+		}
+		var e *Error
+		if !errors.As(err, &e) {
+			t.Fatalf("expected *Error, got %T", err)
+		}
+		if e.Kind != KindMissingRequired || e.Flag != "name" || e.Command != "app db" {
+			t.Errorf("unexpected error fields %+v", e)
+		}
+	})
+
+	t.Run("test-parse-env", func(t *testing.T) {
+		t.Setenv("BROCCOLI_DB_PORT", "http")
+		var app TypedApp
+		_, _, err := Bind(&app, []string{"db", "--name", "x"})
+		if !errors.Is(err, ErrTypeMismatch) {
+			t.Fatalf("expected ErrTypeMismatch, got %v", err)
+		}
+		var e *Error
+		if !errors.As(err, &e) {
+			t.Fatalf("expected *Error, got %T", err)
+		}
+		if e.Kind != KindParse || e.Flag != "port" || e.Value != "http" || e.Source != SourceEnv || e.SourceName != "BROCCOLI_DB_PORT" {
+			t.Errorf("unexpected error fields %+v", e)
+		}
+	})
+
+	t.Run("test-invalid-value", func(t *testing.T) {
+		var app TypedApp
+		_, _, err := Bind(&app, []string{"db", "--name", "x", "--port", "70000"})
+		if !errors.Is(err, ErrInvalidValue) || !errors.Is(err, errOutOfRange) {
+			t.Fatalf("expected ErrInvalidValue wrapping errOutOfRange, got %v", err)
+		}
+		var e *Error
+		if errors.As(err, &e) && (e.Source != SourceArg || e.Value != "70000") {
+			t.Errorf("unexpected error fields %+v", e)
+		}
+	})
+
+	t.Run("test-missing-value", func(t *testing.T) {
+		var app TypedApp
+		_, _, err := Bind(&app, []string{"db", "--name"})
+		if !errors.Is(err, ErrMissingValue) {
+			t.Errorf("expected ErrMissingValue, got %v", err)
+		}
+	})
+
+	t.Run("test-validation", func(t *testing.T) {
+		var app validatorApp
+		_, _, err := Bind(&app, []string{"serve", "--tls-cert", "a.pem"})
+		var e *Error
+		if !errors.As(err, &e) || e.Kind != KindValidation || e.Command != "app serve" {
+			t.Errorf("expected validation error for app serve, got %v", err)
+		}
+		if !errors.Is(err, ErrValidation) {
+			t.Errorf("expected ErrValidation, got %v", err)
+		}
+	})
+}
+
+type exitCodeError struct{}
+
+func (exitCodeError) Error() string { return "runtime failure" }
+func (exitCodeError) ExitCode() int { return 3 }
+
+type exitValidateApp struct {
+	_    struct{} `command:"app"`
+	Fail bool     `flag:"fail"`
+}
+
+func (a exitValidateApp) Validate() error {
+	if a.Fail {
+		return exitCodeError{}
+	}
+	return errors.New("plain failure")
+}
+
+func TestExitCode(t *testing.T) {
+	type ExitApp struct {
+		_    struct{} `command:"app"`
+		Name string   `flag:"name" required:"true"`
+	}
+
+	t.Run("test-mapping", func(t *testing.T) {
+		for _, tc := range []struct {
+			err  error
+			code int
+		}{
+			{nil, 0},
+			{ErrHelp, 0},
+			{errors.New("boom"), 1},
+			{exitCodeError{}, 3},
+			{fmt.Errorf("wrapped: %w", exitCodeError{}), 3},
+		} {
+			if code := ExitCode(tc.err); code != tc.code {
+				t.Errorf("expected exit code %d for %v, got %d", tc.code, tc.err, code)
+			}
+		}
+	})
+
+	t.Run("test-usage-error", func(t *testing.T) {
+		var app ExitApp
+		_, _, err := Bind(&app, []string{})
+		if code := ExitCode(err); code != 2 {
+			t.Errorf("expected exit code 2, got %d", code)
+		}
+		_, _, err = Bind(&app, []string{}, WithUsageExitCode(ExitUsage))
+		if code := ExitCode(err); code != ExitUsage {
+			t.Errorf("expected exit code %d, got %d", ExitUsage, code)
+		}
+		_, _, err = Bind(&app, []string{}, WithUsageExitCode(ExitUsage), WithAllErrors())
+		if code := ExitCode(err); code != ExitUsage {
+			t.Errorf("expected exit code %d for collected errors, got %d", ExitUsage, code)
+		}
+	})
+
+	t.Run("test-validation-error", func(t *testing.T) {
+		var app exitValidateApp
+		_, _, err := Bind(&app, []string{"--fail"}, WithUsageExitCode(ExitUsage))
+		if !errors.Is(err, ErrValidation) {
+			t.Fatalf("expected ErrValidation, got %v", err)
+		}
+		if code := ExitCode(err); code != 3 {
+			t.Errorf("expected the exit code of the Validate error, got %d", code)
+		}
+		app = exitValidateApp{}
+		_, _, err = Bind(&app, []string{}, WithUsageExitCode(ExitUsage))
+		if code := ExitCode(err); code != 1 {
+			t.Errorf("expected exit code 1, got %d", code)
+		}
+	})
+}
+
+func TestDefinitionChecks(t *testing.T) {
+	type SubA struct {
+		_    struct{} `command:"run"`
+		Port int      `flag:"port" default:"http"`
+	}
+	type SubB struct {
+		_ struct{} `command:"run"`
+	}
+	type BrokenApp struct {
+		_       struct{} `command:"app" verison:"1.0.0"`
+		Name    string   `flag:"name" alias:"n"`
+		Other   string   `flag:"name" alias:"n"`
+		Host    string   `flag:"host" alias:"h"`
+		Verbose bool     `flag:"verbose" defualt:"true" json:"verbose"`
+		A       *SubA    `subcommand:"run"`
+		B       *SubB    `subcommand:"run"`
+	}
+
+	_, err := NewApp(&BrokenApp{})
+	if !errors.Is(err, ErrInvalidDefinition) {
+		t.Fatalf("expected ErrInvalidDefinition, got %v", err)
+	}
+	var de *DefinitionError
+	if !errors.As(err, &de) {
+		t.Fatalf("expected *DefinitionError, got %T", err)
+	}
+	expected := []string{
+		`broccoli.BrokenApp._: unknown tag key "verison"`,
+		`broccoli.BrokenApp.Verbose: unknown tag key "defualt"`,
+		`broccoli.SubA.Port: can not parse default "http" as int`,
+		`broccoli.BrokenApp.Other: duplicate flag name "name" (also used by Name)`,
+		`broccoli.BrokenApp.Other: duplicate alias "n" (also used by Name)`,
+		`broccoli.BrokenApp.Host: alias "h" collides with -h`,
+		`broccoli.BrokenApp.B: duplicate subcommand name "run" (also used by A)`,
+	}
+	if !reflect.DeepEqual(de.Problems, expected) {
+		t.Errorf("unexpected problems\n%s", strings.Join(de.Problems, "\n"))
+	}
+}
+
+func TestEnvPrefix(t *testing.T) {
+	type MigrateApp struct {
+		_     struct{} `command:"migrate"`
+		Steps int      `flag:"steps"`
+	}
+	type DBApp struct {
+		_       struct{}    `command:"db"`
+		Host    string      `flag:"host"`
+		Pass    string      `flag:"pass" env:"-"`
+		Migrate *MigrateApp `subcommand:"migrate"`
+	}
+	type PrefixApp struct {
+		DB      *DBApp   `subcommand:"db"`
+		LogFile string   `flag:"log-file"`
+		Port    int      `flag:"port" env:"PORT"`
+		_       struct{} `command:"myapp" env_prefix:"MYAPP"`
+	}
+
+	t.Run("test-derived-names", func(t *testing.T) {
+		t.Setenv("MYAPP_LOG_FILE", "app.log")
+		t.Setenv("PORT", "8080")
+		var app PrefixApp
+		_, _, err := Bind(&app, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if app.LogFile != "app.log" || app.Port != 8080 {
+			t.Errorf("unexpected values %+v", app)
+		}
+	})
+
+	t.Run("test-bool", func(t *testing.T) {
+		type BoolApp struct {
+			_       struct{} `command:"myapp" env_prefix:"MYAPP"`
+			Verbose bool     `flag:"verbose"`
+			Color   bool     `flag:"color" default:"true"`
+		}
+		env := func(value string) Option {
+			return WithLookupEnv(func(name string) (string, bool) {
+				return value, name == "MYAPP_VERBOSE"
+			})
+		}
+		var app BoolApp
+		if _, _, err := Bind(&app, []string{}, env("true")); err != nil {
+			t.Fatal(err)
+		}
+		if !app.Verbose || !app.Color {
+			t.Errorf("expected verbose from the environment and color from its default, got %+v", app)
+		}
+		app = BoolApp{}
+		if _, _, err := Bind(&app, []string{"--!verbose", "--!color"}, env("1")); err != nil {
+			t.Fatal(err)
+		}
+		if app.Verbose || app.Color {
+			t.Errorf("expected arguments to override, got %+v", app)
+		}
+		app = BoolApp{}
+		_, _, err := Bind(&app, []string{}, env("maybe"))
+		if !errors.Is(err, ErrTypeMismatch) || !strings.Contains(err.Error(), "env MYAPP_VERBOSE") {
+			t.Errorf("expected a parse error naming the variable, got %v", err)
+		}
+
+		type InvalidApp struct {
+			E bool `flag:"e" default:"maybe"`
+		}
+		if _, err := NewApp(&InvalidApp{}); !errors.Is(err, ErrInvalidDefinition) {
+			t.Errorf("expected ErrInvalidDefinition for an unparsable bool default, got %v", err)
+		}
+	})
+
+	t.Run("test-subcommand-path", func(t *testing.T) {
+		t.Setenv("MYAPP_DB_HOST", "db.local")
+		t.Setenv("MYAPP_DB_PASS", "secret")
+		t.Setenv("MYAPP_DB_MIGRATE_STEPS", "3")
+		var app PrefixApp
+		if _, _, err := Bind(&app, []string{"db"}); err != nil {
+			t.Fatal(err)
+		}
+		if app.DB.Host != "db.local" {
+			t.Errorf("expected host to be 'db.local', got '%s'", app.DB.Host)
+		}
+		if app.DB.Pass != "" {
+			t.Errorf("expected pass to opt out of env, got '%s'", app.DB.Pass)
+		}
+		if _, _, err := Bind(&app, []string{"db", "migrate"}); err != nil {
+			t.Fatal(err)
+		}
+		if app.DB.Migrate.Steps != 3 {
+			t.Errorf("expected steps to be 3, got %d", app.DB.Migrate.Steps)
+		}
+	})
+
+	t.Run("test-help-and-schema", func(t *testing.T) {
+		a, err := NewApp(&PrefixApp{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(a.Help(), "[env: MYAPP_LOG_FILE]") {
+			t.Errorf("expected help to contain the derived env name, got\n%s", a.Help())
+		}
+		if !strings.Contains(a.Schema(), `"env":"MYAPP_DB_MIGRATE_STEPS"`) {
+			t.Errorf("expected schema to contain the derived env name, got %s", a.Schema())
+		}
+	})
+}
+
+func TestEnvFallback(t *testing.T) {
+	type FallbackApp struct {
+		Port int    `flag:"port" env:"MYAPP_PORT,PORT" default:"80"`
+		Host string `flag:"host" env:"MYAPP_HOST, HOST"`
+	}
+
+	t.Run("test-first-set-wins", func(t *testing.T) {
+		t.Setenv("MYAPP_PORT", "8080")
+		t.Setenv("PORT", "9090")
+		var app FallbackApp
+		if _, _, err := Bind(&app, []string{}); err != nil {
+			t.Fatal(err)
+		}
+		if app.Port != 8080 {
+			t.Errorf("expected port to be 8080, got %d", app.Port)
+		}
+	})
+
+	t.Run("test-fallback-name", func(t *testing.T) {
+		t.Setenv("PORT", "9090")
+		t.Setenv("HOST", "example.com")
+		var app FallbackApp
+		if _, _, err := Bind(&app, []string{}); err != nil {
+			t.Fatal(err)
+		}
+		if app.Port != 9090 || app.Host != "example.com" {
+			t.Errorf("unexpected values %+v", app)
+		}
+	})
+
+	t.Run("test-default", func(t *testing.T) {
+		var app FallbackApp
+		if _, _, err := Bind(&app, []string{}); err != nil {
+			t.Fatal(err)
+		}
+		if app.Port != 80 {
+			t.Errorf("expected port to be 80, got %d", app.Port)
+		}
+	})
+
+	t.Run("test-error-names-variable", func(t *testing.T) {
+		t.Setenv("PORT", "abc")
+		var app FallbackApp
+		_, _, err := Bind(&app, []string{})
+		var e *Error
+		if !errors.As(err, &e) || e.SourceName != "PORT" {
+			t.Fatalf("expected error from env PORT, got %v", err)
+		}
+	})
+
+	t.Run("test-help-and-schema", func(t *testing.T) {
+		a, err := NewApp(&FallbackApp{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(a.Help(), "[env: MYAPP_PORT, PORT]") {
+			t.Errorf("expected help to list every env name, got\n%s", a.Help())
+		}
+		if !strings.Contains(a.Schema(), `"env":"MYAPP_PORT","env_fallback":["PORT"]`) {
+			t.Errorf("expected schema to list every env name, got %s", a.Schema())
+		}
+	})
+}
+
+func TestEnvFiles(t *testing.T) {
+	type SecretApp struct {
+		Password string        `flag:"password" env:"PASSWORD" env_file:"true"`
+		Port     int           `flag:"port" env:"PORT"`
+		Token    string        `flag:"token" env:"TOKEN" env_file:"false"`
+		Timeout  time.Duration `flag:"timeout" env:"TIMEOUT"`
+		Key      string        `flag:"key" env:"KEY" min_len:"20"`
+	}
+	secret := func(t *testing.T, content string) string {
+		p := filepath.Join(t.TempDir(), "secret")
+		if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	t.Run("test-read-file", func(t *testing.T) {
+		t.Setenv("PASSWORD_FILE", secret(t, "s3cret\n"))
+		var app SecretApp
+		if _, _, err := Bind(&app, []string{}); err != nil {
+			t.Fatal(err)
+		}
+		if app.Password != "s3cret" {
+			t.Errorf("expected password to be 's3cret', got %q", app.Password)
+		}
+	})
+
+	t.Run("test-opt-in", func(t *testing.T) {
+		t.Setenv("PORT_FILE", secret(t, "8080"))
+		t.Setenv("TOKEN_FILE", secret(t, "abc"))
+		var app SecretApp
+		if _, _, err := Bind(&app, []string{}); err != nil {
+			t.Fatal(err)
+		}
+		if app.Port != 0 || app.Token != "" {
+			t.Errorf("expected files to be ignored, got %+v", app)
+		}
+		if _, _, err := Bind(&app, []string{}, WithEnvFiles()); err != nil {
+			t.Fatal(err)
+		}
+		if app.Port != 8080 || app.Token != "" {
+			t.Errorf("expected only port to be read from its file, got %+v", app)
+		}
+	})
+
+	t.Run("test-both-set", func(t *testing.T) {
+		t.Setenv("PASSWORD", "s3cret")
+		t.Setenv("PASSWORD_FILE", secret(t, "s3cret"))
+		var app SecretApp
+		_, _, err := Bind(&app, []string{})
+		if !errors.Is(err, ErrConflict) {
+			t.Errorf("expected ErrConflict, got %v", err)
+		}
+	})
+
+	t.Run("test-contents-hidden", func(t *testing.T) {
+		p := secret(t, "hunter2\n")
+		t.Setenv("PORT_FILE", p)
+		var app SecretApp
+		_, _, err := Bind(&app, []string{}, WithEnvFiles())
+		var e *Error
+		if !errors.As(err, &e) || e.Kind != KindParse || e.SourceName != "PORT_FILE" {
+			t.Fatalf("expected parse error from PORT_FILE, got %v", err)
+		}
+		if strings.Contains(err.Error(), "hunter2") || e.Value != "" {
+			t.Errorf("expected error to hide the contents, got %v", err)
+		}
+		if !strings.Contains(err.Error(), p) {
+			t.Errorf("expected error to name the file, got %v", err)
+		}
+	})
+
+	t.Run("test-cause-hidden", func(t *testing.T) {
+		t.Setenv("TIMEOUT_FILE", secret(t, "hunter2\n"))
+		var app SecretApp
+		_, _, err := Bind(&app, []string{}, WithEnvFiles())
+		if !errors.Is(err, ErrTypeMismatch) {
+			t.Fatalf("expected a parse error, got %v", err)
+		}
+		if cause := errors.Unwrap(err); cause == nil || strings.Contains(cause.Error(), "hunter2") {
+			t.Errorf("expected a redacted cause, got %v", cause)
+		}
+		if s := fmt.Sprintf("%+v", err); strings.Contains(s, "hunter2") {
+			t.Errorf("expected the formatted error to hide the contents, got %s", s)
+		}
+	})
+
+	t.Run("test-validation-hidden", func(t *testing.T) {
+		p := secret(t, "hunter2\n")
+		t.Setenv("KEY_FILE", p)
+		var app SecretApp
+		_, _, err := Bind(&app, []string{}, WithEnvFiles())
+		if !errors.Is(err, ErrInvalidValue) {
+			t.Fatalf("expected an invalid value error, got %v", err)
+		}
+		if s := fmt.Sprintf("%+v", err); strings.Contains(s, "length") || strings.Contains(s, "hunter2") {
+			t.Errorf("expected the error to hide the length of the contents, got %s", s)
+		}
+		if cause := errors.Unwrap(err); cause != errRedacted {
+			t.Errorf("expected a redacted cause, got %v", cause)
+		}
+	})
+
+	t.Run("test-missing-file", func(t *testing.T) {
+		p := filepath.Join(t.TempDir(), "missing")
+		t.Setenv("PASSWORD_FILE", p)
+		var app SecretApp
+		_, _, err := Bind(&app, []string{})
+		if !errors.Is(err, ErrInvalidValue) || !errors.Is(err, os.ErrNotExist) || !strings.Contains(err.Error(), p) {
+			t.Errorf("expected error reading %s, got %v", p, err)
+		}
+	})
+}
+
+func TestInjectedEnvironment(t *testing.T) {
+	type RunApp struct {
+		Port int    `flag:"port" env:"PORT" required:"true"`
+		Host string `flag:"host" env:"HOST" default:"localhost"`
+	}
+	env := func(vars map[string]string) func(string) (string, bool) {
+		return func(name string) (string, bool) {
+			v, ok := vars[name]
+			return v, ok
+		}
+	}
+
+	t.Run("test-lookup-env", func(t *testing.T) {
+		t.Parallel()
+		var app RunApp
+		_, _, err := Bind(&app, []string{}, WithLookupEnv(env(map[string]string{"PORT": "8080", "HOST": "example.com"})))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if app.Port != 8080 || app.Host != "example.com" {
+			t.Errorf("unexpected values %+v", app)
+		}
+	})
+
+	t.Run("test-run", func(t *testing.T) {
+		t.Parallel()
+		var app RunApp
+		var stdout, stderr strings.Builder
+		a, err := NewApp(&app, WithArgs([]string{"--port", "80", "file"}), WithLookupEnv(env(nil)),
+			WithOutput(&stdout), WithErrOutput(&stderr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ra, err := a.Run(&app)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if app.Port != 80 || !reflect.DeepEqual(ra, []string{"file"}) {
+			t.Errorf("unexpected values %+v %v", app, ra)
+		}
+		if stdout.Len() != 0 || stderr.Len() != 0 {
+			t.Errorf("expected no output, got %q and %q", stdout.String(), stderr.String())
+		}
+	})
+
+	t.Run("test-run-help", func(t *testing.T) {
+		t.Parallel()
+		var app RunApp
+		var stdout strings.Builder
+		a, err := NewApp(&app, WithName("server"), WithArgs([]string{"--help"}), WithOutput(&stdout))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := a.Run(&app); err != ErrHelp {
+			t.Fatalf("expected ErrHelp, got %v", err)
+		}
+		if !strings.HasPrefix(stdout.String(), "server\n") || !strings.Contains(stdout.String(), "--port") {
+			t.Errorf("expected help for server, got\n%s", stdout.String())
+		}
+	})
+
+	t.Run("test-bind-os-args-exit", func(t *testing.T) {
+		t.Parallel()
+		var app RunApp
+		var stderr strings.Builder
+		code := -1
+		BindOSArgs(&app, WithArgs([]string{}), WithLookupEnv(env(nil)), WithErrOutput(&stderr),
+			WithUsageExitCode(ExitUsage), WithExit(func(c int) { code = c }))
+		if code != ExitUsage {
+			t.Errorf("expected exit status %d, got %d", ExitUsage, code)
+		}
+		if !strings.Contains(stderr.String(), "--port") {
+			t.Errorf("expected error output to name --port, got %q", stderr.String())
+		}
+	})
+}
+
+func TestDotEnv(t *testing.T) {
+	type DotEnvApp struct {
+		Host    string `flag:"host" env:"HOST" default:"localhost"`
+		Port    int    `flag:"port" env:"PORT"`
+		URL     string `flag:"url" env:"URL"`
+		Motd    string `flag:"motd" env:"MOTD"`
+		Raw     string `flag:"raw" env:"RAW"`
+		Level   string `flag:"level" env:"LEVEL"`
+		Timeout int    `flag:"timeout" env:"TIMEOUT" default:"30"`
+	}
+	write := func(t *testing.T, content string) string {
+		p := filepath.Join(t.TempDir(), ".env")
+		if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	env := func(vars map[string]string) Option {
+		return WithLookupEnv(func(name string) (string, bool) {
+			v, ok := vars[name]
+			return v, ok
+		})
+	}
+	const content = `# development settings
+export HOST=db.local
+PORT = 5432 # inline comment
+URL="postgres://${HOST}:$PORT/${NAME:-app}"
+MOTD="hello\n\"world\""
+RAW='$HOST is # literal'
+LEVEL=${LOG_LEVEL}
+`
+
+	t.Run("test-values", func(t *testing.T) {
+		t.Parallel()
+		var app DotEnvApp
+		_, _, err := Bind(&app, []string{}, WithDotEnv(write(t, content)), env(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := DotEnvApp{
+			Host:    "db.local",
+			Port:    5432,
+			URL:     "postgres://db.local:5432/app",
+			Motd:    "hello\n\"world\"",
+			Raw:     "$HOST is # literal",
+			Timeout: 30,
+		}
+		if app != expected {
+			t.Errorf("expected %+v, got %+v", expected, app)
+		}
+	})
+
+	t.Run("test-precedence", func(t *testing.T) {
+		t.Parallel()
+		var app DotEnvApp
+		_, _, err := Bind(&app, []string{"--port", "1"}, WithDotEnv(write(t, content)),
+			env(map[string]string{"HOST": "prod", "LOG_LEVEL": "debug"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if app.Port != 1 || app.Host != "prod" || app.URL != "postgres://prod:5432/app" || app.Level != "debug" {
+			t.Errorf("unexpected values %+v", app)
+		}
+	})
+
+	t.Run("test-override-and-missing", func(t *testing.T) {
+		t.Parallel()
+		missing := filepath.Join(t.TempDir(), ".env.missing")
+		var app DotEnvApp
+		_, _, err := Bind(&app, []string{}, WithDotEnv(write(t, content), write(t, "PORT=6543\n"), missing), env(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if app.Port != 6543 || app.Host != "db.local" {
+			t.Errorf("unexpected values %+v", app)
+		}
+	})
+
+	t.Run("test-error-position", func(t *testing.T) {
+		t.Parallel()
+		var app DotEnvApp
+		_, _, err := Bind(&app, []string{}, WithDotEnv(write(t, "PORT=abc\n")), env(nil))
+		var e *Error
+		if !errors.As(err, &e) || e.Source != SourceDotEnv || e.SourceName != "PORT" || !strings.Contains(err.Error(), ".env:1") {
+			t.Errorf("expected error from PORT in .env:1, got %v", err)
+		}
+	})
+
+	t.Run("test-syntax-error", func(t *testing.T) {
+		t.Parallel()
+		_, err := NewApp(&DotEnvApp{}, WithDotEnv(write(t, "HOST=a\nURL=\"unterminated\n")))
+		if !errors.Is(err, ErrInvalidDotEnv) || !strings.Contains(err.Error(), ".env:2") {
+			t.Errorf("expected ErrInvalidDotEnv at line 2, got %v", err)
+		}
+	})
+
+	t.Run("test-process-env-unchanged", func(t *testing.T) {
+		var app DotEnvApp
+		if _, _, err := Bind(&app, []string{}, WithDotEnv(write(t, "DOTENV_TEST_UNSET=1\n"))); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := os.LookupEnv("DOTENV_TEST_UNSET"); ok {
+			t.Error("expected the process environment to be unchanged")
+		}
+	})
+}
+
+func TestConfigFile(t *testing.T) {
+	type MigrateCmd struct {
+		_     struct{} `command:"migrate"`
+		Steps int      `flag:"steps"`
+	}
+	type DBCmd struct {
+		_       struct{}    `command:"db"`
+		Host    string      `flag:"host" default:"localhost"`
+		Tags    []string    `flag:"tags"`
+		Migrate *MigrateCmd `subcommand:"migrate"`
+	}
+	type ConfigApp struct {
+		Config   string        `flag:"config" config:"true"`
+		Port     int           `flag:"port" env:"PORT" default:"80"`
+		Verbose  bool          `flag:"verbose"`
+		Timeout  time.Duration `flag:"timeout" default:"1s"`
+		Password string        `flag:"password" config:"-"`
+		DB       *DBCmd        `subcommand:"db"`
+	}
+	write := func(t *testing.T, name, content string) string {
+		p := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	noEnv := WithLookupEnv(func(string) (string, bool) { return "", false })
+	const content = `{
+  "port": 8080,
+  "verbose": true,
+  "timeout": "5s",
+  "db": {
+    "host": "db.local",
+    "tags": ["a", "b,c"],
+    "migrate": {"steps": 3}
+  }
+}`
+
+	t.Run("test-values", func(t *testing.T) {
+		t.Parallel()
+		p := write(t, "config.json", content)
+		var app ConfigApp
+		if _, _, err := Bind(&app, []string{"--config", p}, noEnv); err != nil {
+			t.Fatal(err)
+		}
+		if app.Port != 8080 || !app.Verbose || app.Timeout != 5*time.Second {
+			t.Errorf("unexpected values %+v", app)
+		}
+		if _, _, err := Bind(&app, []string{"db"}, WithConfigFile(p), noEnv); err != nil {
+			t.Fatal(err)
+		}
+		if app.DB.Host != "db.local" || !reflect.DeepEqual(app.DB.Tags, []string{"a", "b,c"}) {
+			t.Errorf("unexpected values %+v", app.DB)
+		}
+		if _, _, err := Bind(&app, []string{"db", "migrate"}, WithConfigFile(p), noEnv); err != nil {
+			t.Fatal(err)
+		}
+		if app.DB.Migrate.Steps != 3 {
+			t.Errorf("expected steps to be 3, got %d", app.DB.Migrate.Steps)
+		}
+	})
+
+	t.Run("test-pointer-bool", func(t *testing.T) {
+		t.Parallel()
+		type PointerApp struct {
+			P *bool `flag:"p"`
+			Q *bool `flag:"q"`
+		}
+		for name, content := range map[string]string{
+			"config.json": `{"p": true, "q": false}`,
+			"config.toml": "p = true\nq = false\n",
+			"config.yaml": "p: true\nq: false\n",
+			"config.ini":  "p = true\nq = false\n",
+		} {
+			var app PointerApp
+			if _, _, err := Bind(&app, []string{}, WithConfigFile(write(t, name, content)), noEnv); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if app.P == nil || !*app.P || app.Q == nil || *app.Q {
+				t.Errorf("%s: expected p to be true and q false, got %v and %v", name, app.P, app.Q)
+			}
+		}
+	})
+
+	t.Run("test-parent-config-flag", func(t *testing.T) {
+		t.Parallel()
+		type RootApp struct {
+			Config string `flag:"config" alias:"c" config:"true" env:"MYAPP_CONFIG"`
+			DB     *DBCmd `subcommand:"db"`
+		}
+		p := write(t, "config.json", `{"db": {"host": "db.local", "migrate": {"steps": 3}}}`)
+		env := WithLookupEnv(func(name string) (string, bool) {
+			if name == "MYAPP_CONFIG" {
+				return p, true
+			}
+			return "", false
+		})
+		var app RootApp
+		if _, _, err := Bind(&app, []string{"db", "migrate"}, env); err != nil {
+			t.Fatal(err)
+		}
+		if app.DB.Host != "" || app.DB.Migrate.Steps != 3 {
+			t.Errorf("expected the root config from the environment, got %+v", app.DB.Migrate)
+		}
+
+		app = RootApp{}
+		if _, _, err := Bind(&app, []string{"db", "--config", p}, noEnv); err != nil {
+			t.Fatal(err)
+		}
+		if app.DB.Host != "db.local" {
+			t.Errorf("expected the root config from the argument, got %+v", app.DB)
+		}
+
+		app = RootApp{}
+		ra, _, err := Bind(&app, []string{"db", "-c", write(t, "other.json", `{"db": {"host": "other"}}`), "rest"}, env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if app.DB.Host != "other" || !reflect.DeepEqual(ra, []string{"rest"}) {
+			t.Errorf("expected the argument to override the environment, got %+v and %v", app.DB, ra)
+		}
+
+		type DefaultApp struct {
+			Config string `flag:"config" config:"true" default:"missing.json"`
+			DB     *DBCmd `subcommand:"db"`
+		}
+		var def DefaultApp
+		if _, _, err := Bind(&def, []string{"db"}, noEnv); !errors.Is(err, ErrConfig) {
+			t.Errorf("expected the default config file to be read, got %v", err)
+		}
+	})
+
+	t.Run("test-precedence", func(t *testing.T) {
+		t.Parallel()
+		p := write(t, "config.json", content)
+		env := WithLookupEnv(func(name string) (string, bool) {
+			if name == "PORT" {
+				return "9090", true
+			}
+			return "", false
+		})
+		var app ConfigApp
+		if _, _, err := Bind(&app, []string{"--config", p}, env); err != nil {
+			t.Fatal(err)
+		}
+		if app.Port != 9090 {
+			t.Errorf("expected env to override the config file, got %d", app.Port)
+		}
+		if _, _, err := Bind(&app, []string{"--config", p, "--port", "1"}, env); err != nil {
+			t.Fatal(err)
+		}
+		if app.Port != 1 {
+			t.Errorf("expected the argument to override env, got %d", app.Port)
+		}
+		app = ConfigApp{}
+		if _, _, err := Bind(&app, []string{}, noEnv); err != nil {
+			t.Fatal(err)
+		}
+		if app.Port != 80 || app.Verbose {
+			t.Errorf("expected defaults without a config file, got %+v", app)
+		}
+	})
+
+	t.Run("test-unknown-keys", func(t *testing.T) {
+		t.Parallel()
+		p := write(t, "config.json", "{\n  \"prot\": 1,\n  \"password\": \"x\",\n  \"db\": {\"hots\": \"a\"}\n}")
+		var app ConfigApp
+		_, _, err := Bind(&app, []string{"--config", p}, noEnv, WithAllErrors())
+		if !errors.Is(err, ErrConfig) {
+			t.Fatalf("expected ErrConfig, got %v", err)
+		}
+		for _, s := range []string{`config.json:2: unknown key "prot"`, `config.json:3: key "password" can not be set`, `config.json:4: unknown key "db.hots"`} {
+			if !strings.Contains(err.Error(), s) {
+				t.Errorf("expected error to contain %s, got %v", s, err)
+			}
+		}
+	})
+
+	t.Run("test-type-error", func(t *testing.T) {
+		t.Parallel()
+		p := write(t, "config.json", "{\n  \"db\": {\n    \"migrate\": {\"steps\": \"many\"}\n  }\n}")
+		var app ConfigApp
+		_, _, err := Bind(&app, []string{"db", "migrate"}, WithConfigFile(p), noEnv)
+		var e *Error
+		if !errors.As(err, &e) || e.Kind != KindParse || e.Source != SourceConfig || e.SourceName != "db.migrate.steps" {
+			t.Fatalf("expected parse error from db.migrate.steps, got %v", err)
+		}
+		if !strings.Contains(err.Error(), "config.json:3") {
+			t.Errorf("expected error to contain the position, got %v", err)
+		}
+		p = write(t, "config.json", `{"port": [1, 2]}`)
+		if _, _, err := Bind(&app, []string{}, WithConfigFile(p), noEnv); !errors.Is(err, ErrTypeMismatch) {
+			t.Errorf("expected ErrTypeMismatch for a list, got %v", err)
+		}
+	})
+
+	t.Run("test-syntax-error", func(t *testing.T) {
+		t.Parallel()
+		p := write(t, "config.json", "{\n  \"port\": 1,\n  \"verbose\" true\n}")
+		var app ConfigApp
+		_, _, err := Bind(&app, []string{"--config", p}, noEnv)
+		if !errors.Is(err, ErrConfig) || !strings.Contains(err.Error(), "config.json:3") {
+			t.Errorf("expected ErrConfig at line 3, got %v", err)
+		}
+		_, _, err = Bind(&app, []string{"--config", filepath.Join(t.TempDir(), "missing.json")}, noEnv)
+		if !errors.Is(err, ErrConfig) || !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected ErrConfig for a missing file, got %v", err)
+		}
+	})
+
+	t.Run("test-schema", func(t *testing.T) {
+		t.Parallel()
+		a, err := NewApp(&ConfigApp{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		schema := a.Schema()
+		for _, s := range []string{`"name":"config","kind":"string","about":"","index":0,"required":false,"config":true}`, `"name":"port","kind":"int","about":"","index":1,"default":"80","env":"PORT","required":false,"configurable":true}`, `"name":"password","kind":"string","about":"","index":4,"required":false}`} {
+			if !strings.Contains(schema, s) {
+				t.Errorf("expected schema to contain %s, got %s", s, schema)
+			}
+		}
+	})
+}
+
+func TestTOMLConfig(t *testing.T) {
+	type MigrateCmd struct {
+		_     struct{} `command:"migrate"`
+		Steps int      `flag:"steps"`
+	}
+	type DBCmd struct {
+		_       struct{}          `command:"db"`
+		Host    string            `flag:"host"`
+		Ports   []int             `flag:"ports"`
+		Labels  map[string]string `flag:"labels"`
+		Migrate *MigrateCmd       `subcommand:"migrate"`
+	}
+	type TOMLApp struct {
+		Name    string            `flag:"name"`
+		Motd    string            `flag:"motd"`
+		Pattern string            `flag:"pattern"`
+		Rate    float64           `flag:"rate"`
+		Mask    uint8             `flag:"mask"`
+		Verbose bool              `flag:"verbose"`
+		Since   time.Time         `flag:"since"`
+		Limits  map[string]int    `flag:"limits"`
+		Tags    map[string]string `flag:"tags"`
+		DB      *DBCmd            `subcommand:"db"`
+	}
+	write := func(t *testing.T, content string) string {
+		p := filepath.Join(t.TempDir(), "config.toml")
+		if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	noEnv := WithLookupEnv(func(string) (string, bool) { return "", false })
+	const content = `# service settings
+name = "api \"v2\"" # trailing comment
+motd = """
+Hello,\
+  world!"""
+pattern = '\d+'
+rate = 1_000.5
+mask = 0xff
+verbose = true
+since = 1979-05-27 07:32:00Z
+limits = { cpu = 2, memory = 512 }
+
+[tags]
+team = "core"
+
+[db]
+host = "db.local"
+ports = [
+  5432, # primary
+  5433,
+]
+labels = { role = "primary", "zone.name" = 'eu' }
+migrate.steps = 3
+`
+
+	t.Run("test-values", func(t *testing.T) {
+		t.Parallel()
+		p := write(t, content)
+		var app TOMLApp
+		if _, _, err := Bind(&app, []string{}, WithConfigFile(p), noEnv); err != nil {
+			t.Fatal(err)
+		}
+		expected := TOMLApp{
+			Name:    `api "v2"`,
+			Motd:    "Hello,world!",
+			Pattern: `\d+`,
+			Rate:    1000.5,
+			Mask:    0xff,
+			Verbose: true,
+			Since:   time.Date(1979, 5, 27, 7, 32, 0, 0, time.UTC),
+			Limits:  map[string]int{"cpu": 2, "memory": 512},
+			Tags:    map[string]string{"team": "core"},
+		}
+		if !reflect.DeepEqual(app, expected) {
+			t.Errorf("expected %+v, got %+v", expected, app)
+		}
+
+		if _, _, err := Bind(&app, []string{"db"}, WithConfigFile(p), noEnv); err != nil {
+			t.Fatal(err)
+		}
+		if app.DB.Host != "db.local" || !reflect.DeepEqual(app.DB.Ports, []int{5432, 5433}) ||
+			!reflect.DeepEqual(app.DB.Labels, map[string]string{"role": "primary", "zone.name": "eu"}) {
+			t.Errorf("unexpected values %+v", app.DB)
+		}
+		if _, _, err := Bind(&app, []string{"db", "migrate"}, WithConfigFile(p), noEnv); err != nil {
+			t.Fatal(err)
+		}
+		if app.DB.Migrate.Steps != 3 {
+			t.Errorf("expected steps to be 3, got %d", app.DB.Migrate.Steps)
+		}
+	})
+
+	t.Run("test-map-flag-argument", func(t *testing.T) {
+		t.Parallel()
+		var app TOMLApp
+		if _, _, err := Bind(&app, []string{"--limits", "cpu=4,memory=1024"}, noEnv); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(app.Limits, map[string]int{"cpu": 4, "memory": 1024}) {
+			t.Errorf("unexpected limits %v", app.Limits)
+		}
+		if _, _, err := Bind(&app, []string{"--limits", "cpu"}, noEnv); !errors.Is(err, ErrTypeMismatch) {
+			t.Errorf("expected ErrTypeMismatch, got %v", err)
+		}
+	})
+
+	t.Run("test-type-errors", func(t *testing.T) {
+		t.Parallel()
+		for _, tc := range []struct {
+			content string
+			args    []string
+			want    string
+		}{
+			{"name = 'a'\n\n[db]\nports = [1, 'x']\n", []string{"db"}, `for --ports (from config key db.ports at `},
+			{"limits = { cpu = 'many' }\n", nil, `for --limits (from config key limits at `},
+			{"verbose = 'yes'\n", nil, `can not parse "yes" as bool for --verbose (from config key verbose at `},
+			{"name = [1]\n", nil, `can not parse ["1"] as string for --name`},
+			{"mask = { a = 1 }\n", nil, `for --mask (from config key mask at `},
+		} {
+			p := write(t, tc.content)
+			var app TOMLApp
+			_, _, err := Bind(&app, tc.args, WithConfigFile(p), noEnv)
+			if !errors.Is(err, ErrTypeMismatch) || !strings.Contains(err.Error(), tc.want) || !strings.Contains(err.Error(), "config.toml:") {
+				t.Errorf("expected error containing %s, got %v", tc.want, err)
+			}
+		}
+	})
+
+	t.Run("test-syntax-errors", func(t *testing.T) {
+		t.Parallel()
+		for _, tc := range []struct {
+			content string
+			want    string
+		}{
+			{"name = 'a'\nname = 'b'\n", `config.toml:2: key "name" is already defined`},
+			{"[db]\nhost = 'a'\n[db]\n", `config.toml:3: table "db" is already defined`},
+			{"name = \"unterminated\n", `config.toml:1: unterminated string`},
+			{"rate = 1.2.3\n", `config.toml:1: invalid value "1.2.3"`},
+			{"\n\nname 'a'\n", `config.toml:3: expected = after the key "name"`},
+			{"ports = [1, 2\nname = 'a'\n", `config.toml:2: expected , or ] in array`},
+			{"name = 'a' 'b'\n", `config.toml:1: unexpected "'" at the end of the line`},
+		} {
+			p := write(t, tc.content)
+			var app TOMLApp
+			_, _, err := Bind(&app, nil, WithConfigFile(p), noEnv)
+			if !errors.Is(err, ErrConfig) || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("expected error containing %s, got %v", tc.want, err)
+			}
+		}
+	})
+}
+
+func TestYAMLConfig(t *testing.T) {
+	type MigrateCmd struct {
+		_     struct{} `command:"migrate"`
+		Steps int      `flag:"steps"`
+	}
+	type DBCmd struct {
+		_       struct{}          `command:"db"`
+		Host    string            `flag:"host"`
+		Ports   []int             `flag:"ports"`
+		Labels  map[string]string `flag:"labels"`
+		Migrate *MigrateCmd       `subcommand:"migrate"`
+	}
+	type YAMLApp struct {
+		Name    string   `flag:"name"`
+		Motd    string   `flag:"motd"`
+		Summary string   `flag:"summary"`
+		Quote   string   `flag:"quote"`
+		Port    int      `flag:"port" default:"80"`
+		Verbose bool     `flag:"verbose"`
+		Hosts   []string `flag:"hosts"`
+		Tags    []string `flag:"tags"`
+		DB      *DBCmd   `subcommand:"db"`
+	}
+	write := func(t *testing.T, content string) string {
+		p := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	noEnv := WithLookupEnv(func(string) (string, bool) { return "", false })
+	const content = `---
+# service settings
+name: api # trailing comment
+motd: |
+  Hello,
+    world!
+summary: >-
+  folded
+  text
+
+  paragraph
+quote: 'it''s "#1"'
+port: ~
+verbose: true
+hosts:
+- a.example.com
+- "b.example.com"
+tags: [x, "y, z"]
+db:
+  host: db.local
+  ports:
+    - 5432
+    - 5433
+  labels: {role: primary, zone: eu}
+  migrate:
+    steps: 3
+`
+
+	t.Run("test-values", func(t *testing.T) {
+		t.Parallel()
+		p := write(t, content)
+		var app YAMLApp
+		if _, _, err := Bind(&app, []string{}, WithConfigFile(p), noEnv); err != nil {
+			t.Fatal(err)
+		}
+		expected := YAMLApp{
+			Name:    "api",
+			Motd:    "Hello,\n  world!\n",
+			Summary: "folded text\nparagraph",
+			Quote:   `it's "#1"`,
+			Port:    80,
+			Verbose: true,
+			Hosts:   []string{"a.example.com", "b.example.com"},
+			Tags:    []string{"x", "y, z"},
+		}
+		if !reflect.DeepEqual(app, expected) {
+			t.Errorf("expected %+v, got %+v", expected, app)
+		}
+
+		if _, _, err := Bind(&app, []string{"db", "migrate"}, WithConfigFile(p), noEnv); err != nil {
+			t.Fatal(err)
+		}
+		if app.DB.Migrate.Steps != 3 {
+			t.Errorf("expected steps to be 3, got %d", app.DB.Migrate.Steps)
+		}
+		if _, _, err := Bind(&app, []string{"db"}, WithConfigFile(write(t, content)), noEnv); err != nil {
+			t.Fatal(err)
+		}
+		if app.DB.Host != "db.local" || !reflect.DeepEqual(app.DB.Ports, []int{5432, 5433}) ||
+			!reflect.DeepEqual(app.DB.Labels, map[string]string{"role": "primary", "zone": "eu"}) {
+			t.Errorf("unexpected values %+v", app.DB)
+		}
+	})
+
+	t.Run("test-tabs-in-block-scalar", func(t *testing.T) {
+		t.Parallel()
+		p := write(t, "motd: |\n  a\tb\n  \tc\n")
+		var app YAMLApp
+		if _, _, err := Bind(&app, []string{}, WithConfigFile(p), noEnv); err != nil {
+			t.Fatal(err)
+		}
+		if app.Motd != "a\tb\n\tc\n" {
+			t.Errorf("expected tabs to be kept, got %q", app.Motd)
+		}
+	})
+
+	t.Run("test-errors", func(t *testing.T) {
+		t.Parallel()
+		for _, tc := range []struct {
+			content string
+			args    []string
+			want    error
+			msg     string
+		}{
+			{"name: a\nname: b\n", nil, ErrConfig, `config.yaml:2: duplicate key "name"`},
+			{"db:\n  host: a\n    port: 1\n", nil, ErrConfig, `config.yaml:3: unexpected indentation`},
+			{"name: &x a\n", nil, ErrConfig, `config.yaml:1: anchors, aliases and tags are not supported`},
+			{"name: a\n---\nname: b\n", nil, ErrConfig, `config.yaml:2: multiple documents are not supported`},
+			{"tags: [a, b\n", nil, ErrConfig, `config.yaml:1: unterminated flow collection`},
+			{"name: \"a\n", nil, ErrConfig, `config.yaml:1: unterminated quoted scalar`},
+			{"- a\n- b\n", nil, ErrConfig, `config.yaml:1: expected a mapping at the top level`},
+			{": foo\n", nil, ErrConfig, `config.yaml:1: expected a key`},
+			{"name: a\n: \n", nil, ErrConfig, `config.yaml:2: expected a key`},
+			{"db:\n\thost: a\n", nil, ErrConfig, `config.yaml:2: tabs can not be used for indentation`},
+			{"nmae: a\n", nil, ErrConfig, `config.yaml:1: unknown key "nmae"`},
+			{"db:\n  ports:\n    - 1\n    - x\n", []string{"db"}, ErrTypeMismatch, `config.yaml:2)`},
+			{"port: [1]\n", nil, ErrTypeMismatch, `can not parse ["1"] as int for --port (from config key port at `},
+		} {
+			p := write(t, tc.content)
+			var app YAMLApp
+			_, _, err := Bind(&app, tc.args, WithConfigFile(p), noEnv)
+			if !errors.Is(err, tc.want) || !strings.Contains(err.Error(), tc.msg) {
+				t.Errorf("expected error containing %s, got %v", tc.msg, err)
+			}
+		}
+	})
+}
+
+func TestINIConfig(t *testing.T) {
+	type MigrateCmd struct {
+		_     struct{} `command:"migrate"`
+		Steps int      `flag:"steps"`
+		Dirs  []string `flag:"dirs"`
+	}
+	type DBCmd struct {
+		_       struct{}          `command:"db"`
+		Host    string            `flag:"host"`
+		Labels  map[string]string `flag:"labels"`
+		Migrate *MigrateCmd       `subcommand:"migrate"`
+	}
+	type INIApp struct {
+		Name    string   `flag:"name"`
+		Motd    string   `flag:"motd"`
+		Port    int      `flag:"port" default:"80" env:"PORT"`
+		Level   string   `flag:"level" default:"info"`
+		Verbose bool     `flag:"verbose"`
+		Hosts   []string `flag:"hosts"`
+		DB      *DBCmd   `subcommand:"db"`
+	}
+	write := func(t *testing.T, content string) string {
+		p := filepath.Join(t.TempDir(), "config.ini")
+		if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	noEnv := WithLookupEnv(func(string) (string, bool) { return "", false })
+	const content = `; service settings
+name = api ; trailing comment
+motd = "hello ; world"
+port: 8080
+verbose = true
+hosts = a.example.com
+hosts = b.example.com
+
+[db]
+host = db.local
+
+[db.labels]
+role = primary
+zone = eu
+
+# migrations
+[db.migrate]
+steps = 3
+dirs = up
+dirs = down
+`
+
+	t.Run("test-values", func(t *testing.T) {
+		t.Parallel()
+		p := write(t, content)
+		var app INIApp
+		if _, _, err := Bind(&app, []string{}, WithConfigFile(p), noEnv); err != nil {
+			t.Fatal(err)
+		}
+		expected := INIApp{
+			Name:    "api",
+			Motd:    "hello ; world",
+			Port:    8080,
+			Level:   "info",
+			Verbose: true,
+			Hosts:   []string{"a.example.com", "b.example.com"},
+		}
+		if !reflect.DeepEqual(app, expected) {
+			t.Errorf("expected %+v, got %+v", expected, app)
+		}
+
+		app = INIApp{}
+		if _, _, err := Bind(&app, []string{"db", "migrate"}, WithConfigFile(p), noEnv); err != nil {
+			t.Fatal(err)
+		}
+		if app.DB.Migrate.Steps != 3 || !reflect.DeepEqual(app.DB.Migrate.Dirs, []string{"up", "down"}) {
+			t.Errorf("unexpected values %+v", app.DB.Migrate)
+		}
+
+		app = INIApp{}
+		if _, _, err := Bind(&app, []string{"db"}, WithConfigFile(p), noEnv); err != nil {
+			t.Fatal(err)
+		}
+		if app.DB.Host != "db.local" || !reflect.DeepEqual(app.DB.Labels, map[string]string{"role": "primary", "zone": "eu"}) {
+			t.Errorf("unexpected values %+v", app.DB)
+		}
+	})
+
+	t.Run("test-precedence", func(t *testing.T) {
+		t.Parallel()
+		p := write(t, "port = 8080\nlevel = debug\nname = api\n")
+		env := WithLookupEnv(func(name string) (string, bool) {
+			if name == "PORT" {
+				return "9090", true
+			}
+			return "", false
+		})
+		var app INIApp
+		if _, _, err := Bind(&app, []string{"--name", "cli"}, WithConfigFile(p), env); err != nil {
+			t.Fatal(err)
+		}
+		if app.Name != "cli" || app.Port != 9090 || app.Level != "debug" {
+			t.Errorf("unexpected values %+v", app)
+		}
+	})
+
+	t.Run("test-errors", func(t *testing.T) {
+		t.Parallel()
+		for _, tc := range []struct {
+			content string
+			args    []string
+			want    error
+			msg     string
+		}{
+			{"[db\nhost = a\n", nil, ErrConfig, `config.ini:1: expected ] after the section name`},
+			{"[]\n", nil, ErrConfig, `config.ini:1: expected a section name`},
+			{"[db.]\n", nil, ErrConfig, `config.ini:1: invalid section name "db."`},
+			{"name = a\n[name]\n", nil, ErrConfig, `config.ini:2: section "name" is already defined as a key`},
+			{"[db.labels]\nrole = a\n[db]\nlabels = b\n", nil, ErrConfig, `config.ini:4: key "db.labels" is already defined as a section`},
+			{"name\n", nil, ErrConfig, `config.ini:1: expected key = value`},
+			{"= a\n", nil, ErrConfig, `config.ini:1: expected a key before =`},
+			{"[db] x\n", nil, ErrConfig, `config.ini:1: unexpected "x" after the section`},
+			{"nmae = a\n", nil, ErrConfig, `config.ini:1: unknown key "nmae"`},
+			{"[db]\nhots = a\n", nil, ErrConfig, `config.ini:2: unknown key "db.hots"`},
+			{"port = 1\nport = 2\n", nil, ErrTypeMismatch, `can not parse ["1", "2"] as int for --port (from config key port at `},
+		} {
+			p := write(t, tc.content)
+			var app INIApp
+			_, _, err := Bind(&app, tc.args, WithConfigFile(p), noEnv)
+			if !errors.Is(err, tc.want) || !strings.Contains(err.Error(), tc.msg) {
+				t.Errorf("expected error containing %s, got %v", tc.msg, err)
+			}
+		}
+	})
+}
+
+func TestConfigDiscovery(t *testing.T) {
+	type DBCmd struct {
+		_    struct{} `command:"db"`
+		Host string   `flag:"host"`
+		Port int      `flag:"port"`
+	}
+	type DiscoveryApp struct {
+		_      struct{} `command:"broccoli-discovery-test"`
+		Config string   `flag:"config" config:"true"`
+		Name   string   `flag:"name" default:"default"`
+		Level  string   `flag:"level"`
+		Port   int      `flag:"port"`
+		DB     *DBCmd   `subcommand:"db"`
+	}
+	write := func(t *testing.T, path, content string) string {
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	env := func(vars map[string]string) Option {
+		return WithLookupEnv(func(name string) (string, bool) {
+			v, ok := vars[name]
+			return v, ok
+		})
+	}
+	const app = "broccoli-discovery-test"
+
+	t.Run("test-search-path", func(t *testing.T) {
+		t.Parallel()
+		a, err := NewApp(&DiscoveryApp{}, WithConfigDiscovery(), WithConfigPathsInHelp(),
+			env(map[string]string{"XDG_CONFIG_HOME": "/xdg", "HOME": "/home/u"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []string{"/etc/" + app + "/config.*", "/xdg/" + app + "/config.*", "./." + app + "rc"}
+		if !reflect.DeepEqual(a.configSearch, expected) {
+			t.Errorf("expected %v, got %v", expected, a.configSearch)
+		}
+		help := "Config files:\n\t/etc/" + app + "/config.*\n\t/xdg/" + app + "/config.*\n\t./." + app + "rc\n"
+		if !strings.HasSuffix(a.Help(), help) {
+			t.Errorf("expected help to end with\n%s\ngot\n%s", help, a.Help())
+		}
+		sub := a.sub(&a.c.SubCommands[0])
+		if !strings.HasSuffix(sub.Help(), help) {
+			t.Errorf("expected subcommand help to end with\n%s\ngot\n%s", help, sub.Help())
+		}
+
+		a, err = NewApp(&DiscoveryApp{}, WithConfigDiscovery(), env(map[string]string{"XDG_CONFIG_HOME": "relative", "HOME": "/home/u"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.configSearch[1] != "/home/u/.config/"+app+"/config.*" {
+			t.Errorf("expected the home directory to be searched, got %v", a.configSearch)
+		}
+		if strings.Contains(a.Help(), "Config files:") {
+			t.Errorf("expected no config files in help, got\n%s", a.Help())
+		}
+
+		a, err = NewApp(&DiscoveryApp{}, WithConfigDiscovery(), WithConfigPathsInHelp(), WithConfigFile("app.toml"), env(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasSuffix(a.Help(), "Config files:\n\tapp.toml\n") {
+			t.Errorf("expected help to list the config file, got\n%s", a.Help())
+		}
+	})
+
+	t.Run("test-merge", func(t *testing.T) {
+		xdg := t.TempDir()
+		write(t, filepath.Join(xdg, app, "config.toml"), "level = \"warn\"\nport = 1\n\n[db]\nhost = \"user.local\"\nport = 5432\n")
+		write(t, filepath.Join(xdg, app, "config.yaml"), "level: ignored\n")
+		project := t.TempDir()
+		write(t, filepath.Join(project, "."+app+"rc"), "port = 2\n\n[db]\nport = 6432\n")
+		wd, err := os.Getwd()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chdir(project); err != nil {
+			t.Fatal(err)
+		}
+		defer os.Chdir(wd)
+		opts := []Option{WithConfigDiscovery(), env(map[string]string{"XDG_CONFIG_HOME": xdg})}
+
+		var cfg DiscoveryApp
+		if _, _, err := Bind(&cfg, []string{}, opts...); err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Name != "default" || cfg.Level != "warn" || cfg.Port != 2 {
+			t.Errorf("unexpected values %+v", cfg)
+		}
+		cfg = DiscoveryApp{}
+		if _, _, err := Bind(&cfg, []string{"db"}, opts...); err != nil {
+			t.Fatal(err)
+		}
+		if cfg.DB.Host != "user.local" || cfg.DB.Port != 6432 {
+			t.Errorf("unexpected values %+v", cfg.DB)
+		}
+
+		explicit := write(t, filepath.Join(t.TempDir(), "explicit.json"), `{"port": 3}`)
+		cfg = DiscoveryApp{}
+		if _, _, err := Bind(&cfg, []string{"--config", explicit}, opts...); err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Level != "" || cfg.Port != 3 {
+			t.Errorf("expected --config to override discovery, got %+v", cfg)
+		}
+
+		// An unreadable file in a discovery location is skipped, while the next extension is still found
+		if err := os.MkdirAll(filepath.Join(xdg, app, "config.ini"), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		cfg = DiscoveryApp{}
+		if _, _, err := Bind(&cfg, []string{}, opts...); err != nil {
+			t.Fatalf("expected unreadable discovered files to be skipped, got %v", err)
+		}
+		if cfg.Level != "warn" {
+			t.Errorf("expected the next readable file to be used, got %+v", cfg)
+		}
+		_, _, err = Bind(&cfg, []string{"--config", filepath.Join(xdg, app, "config.ini")}, opts...)
+		if !errors.Is(err, ErrConfig) {
+			t.Errorf("expected an explicit unreadable file to fail, got %v", err)
+		}
+
+		write(t, filepath.Join(project, "."+app+"rc"), "prot = 2\n")
+		_, _, err = Bind(&cfg, []string{}, opts...)
+		if !errors.Is(err, ErrConfig) || !strings.Contains(err.Error(), "."+app+"rc:1: unknown key \"prot\"") {
+			t.Errorf("expected an unknown key error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,489 @@
+package broccoli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// configKind is the kind of a configValue.
+type configKind int
+
+const (
+	configScalar configKind = iota
+	configList
+	configTable
+)
+
+// configValue is a node of a parsed config file: a scalar, a list or a table, with the position it was
+// defined at, e.g. "config.json:3". Every config format is parsed into this tree, so key mapping,
+// unknown key checks and value conversion are shared by all of them.
+type configValue struct {
+	kind  configKind
+	value string
+	list  []*configValue
+	keys  []string
+	table map[string]*configValue
+	pos   string
+}
+
+func newConfigTable(pos string) *configValue {
+	return &configValue{kind: configTable, table: map[string]*configValue{}, pos: pos}
+}
+
+// set sets the key of the table t to v, keeping the keys in the order they were defined.
+func (t *configValue) set(key string, v *configValue) {
+	if _, ok := t.table[key]; !ok {
+		t.keys = append(t.keys, key)
+	}
+	t.table[key] = v
+}
+
+// get returns the value of the key of the table t, or nil. t may be nil.
+func (t *configValue) get(key string) *configValue {
+	if t == nil || t.kind != configTable {
+		return nil
+	}
+	return t.table[key]
+}
+
+// describe names the kind of v for error messages.
+func (v *configValue) describe() string {
+	switch v.kind {
+	case configList:
+		return "a list"
+	case configTable:
+		return "a table"
+	}
+	return "a value"
+}
+
+// configErrorf returns an Error of kind KindConfig for the position pos.
+func configErrorf(pos string, format string, args ...interface{}) *Error {
+	return &Error{Kind: KindConfig, msg: pos + ": " + fmt.Sprintf(format, args...)}
+}
+
+// configFormats maps the extensions of config files to their parsers.
+var configFormats = map[string]func(path string, data []byte) (*configValue, error){
+	".ini":  parseINIConfig,
+	".json": parseJSONConfig,
+	".toml": parseTOMLConfig,
+	".yaml": parseYAMLConfig,
+	".yml":  parseYAMLConfig,
+}
+
+// readConfig reads the config file path, choosing the parser by its extension.
+func readConfig(path string) (*configValue, error) {
+	parse, ok := configFormats[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return nil, &Error{Kind: KindConfig, msg: fmt.Sprintf("unsupported config file format %s", strconv.Quote(path))}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, &Error{Kind: KindConfig, Err: err, msg: fmt.Sprintf("can not read config file: %v", err)}
+	}
+	return parse(path, data)
+}
+
+// loadConfig reads the config file named by the config flag of cmd, if set, or by the config flag of a parent
+// command, or by WithConfigFile, or else the files found by WithConfigDiscovery. configArg is the value of the
+// config flag of a parent command given as an argument, if any. It returns the table of cmd in the file together
+// with the unknown keys of the whole file.
+func (a *App) loadConfig(cmd *command, dst reflect.Value, sources []valueSource, configArg *string) (*configValue, Errors) {
+	var path string
+	for i := range cmd.Flags {
+		if cmd.Flags[i].Config && sources[i].set() {
+			v := dst.Field(cmd.Flags[i].Index)
+			for v.Kind() == reflect.Pointer && !v.IsNil() {
+				v = v.Elem()
+			}
+			if v.Kind() == reflect.String {
+				path = v.String()
+			}
+		}
+	}
+	if f := cmd.inheritedConfigFlag(); path == "" && f != nil {
+		// The flags of parent commands are not bound when a subcommand runs, so the value is looked up here
+		var err error
+		switch {
+		case configArg != nil:
+			path = *configArg
+		default:
+			var ok bool
+			_, path, ok, err = a.lookupFlagEnv(f, a.processEnv)
+			if !ok && err == nil && a.dotEnv != nil {
+				_, path, ok, err = a.lookupFlagEnv(f, a.dotEnv.lookup)
+			}
+			if !ok && err == nil && f.Default != nil {
+				path = *f.Default
+			}
+		}
+		if err != nil {
+			return nil, Errors{err}
+		}
+	}
+	if path == "" {
+		path = a.configFile
+	}
+
+	var root *configValue
+	var err error
+	switch {
+	case path != "":
+		root, err = readConfig(path)
+	case a.configDiscovery:
+		root, err = discoverConfig(a.configSearch)
+	}
+	if err != nil {
+		return nil, Errors{err}
+	}
+	if root == nil {
+		return nil, nil
+	}
+	return cmd.configTable(root), a.c.checkConfig(root, "")
+}
+
+// inheritedConfigFlag returns the config flag of the nearest parent command of cmd that has one, or nil.
+func (cmd *command) inheritedConfigFlag() *fieldMeta {
+	for c := cmd.Parent; c != nil; c = c.Parent {
+		for i := range c.Flags {
+			if c.Flags[i].Config {
+				return &c.Flags[i]
+			}
+		}
+	}
+	return nil
+}
+
+// configSearchPath returns the config files discovery looks for, from system to user to project:
+// /etc/<app>/config.*, $XDG_CONFIG_HOME/<app>/config.* or ~/.config/<app>/config.*, and ./.<app>rc.
+// A name ending in ".*" stands for every supported extension.
+func (a *App) configSearchPath() []string {
+	app := a.c.Command
+	paths := []string{filepath.Join("/etc", app, "config.*")}
+	if dir, ok := a.lookupEnv("XDG_CONFIG_HOME"); ok && filepath.IsAbs(dir) {
+		paths = append(paths, filepath.Join(dir, app, "config.*"))
+	} else if home, ok := a.lookupEnv("HOME"); ok && home != "" {
+		paths = append(paths, filepath.Join(home, ".config", app, "config.*"))
+	}
+	return append(paths, "./."+app+"rc")
+}
+
+// addConfigHelp lists the config files paths at the end of the help messages of cmd and its subcommands.
+func (cmd *command) addConfigHelp(paths []string) {
+	if len(paths) == 0 {
+		return
+	}
+	var sb strings.Builder
+	sb.WriteString(cmd.Help)
+	if !strings.HasSuffix(cmd.Help, "\n\n") {
+		sb.WriteRune('\n')
+	}
+	sb.WriteString("Config files:\n")
+	for _, p := range paths {
+		sb.WriteString("\t")
+		sb.WriteString(p)
+		sb.WriteRune('\n')
+	}
+	cmd.Help = sb.String()
+	for i := range cmd.SubCommands {
+		cmd.SubCommands[i].addConfigHelp(paths)
+	}
+}
+
+// discoverConfig reads the files of the search path that exist and merges them, later files overriding
+// earlier ones. For a name ending in ".*" the first readable extension in alphabetical order is read, and
+// a file without extension is read as INI. Files that can not be read are skipped, but syntax errors are
+// reported. It returns nil if no file can be read.
+func discoverConfig(search []string) (*configValue, error) {
+	exts := make([]string, 0, len(configFormats))
+	for ext := range configFormats {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+
+	var root *configValue
+	for _, p := range search {
+		candidates := []string{p}
+		if strings.HasSuffix(p, ".*") {
+			candidates = candidates[:0]
+			for _, ext := range exts {
+				candidates = append(candidates, strings.TrimSuffix(p, ".*")+ext)
+			}
+		}
+		for _, c := range candidates {
+			parse, ok := configFormats[strings.ToLower(filepath.Ext(c))]
+			if !ok {
+				parse = parseINIConfig
+			}
+			// Files that can not be read are skipped like missing ones, as nobody asked for them
+			data, err := os.ReadFile(c)
+			if err != nil {
+				continue
+			}
+			v, err := parse(c, data)
+			if err != nil {
+				return nil, err
+			}
+			root = mergeConfig(root, v)
+			break
+		}
+	}
+	return root, nil
+}
+
+// mergeConfig merges the config value src into dst and returns the result. Tables are merged key by key,
+// and any other value of src replaces the one of dst. dst may be nil.
+func mergeConfig(dst, src *configValue) *configValue {
+	if dst == nil || dst.kind != configTable || src.kind != configTable {
+		return src
+	}
+	for _, k := range src.keys {
+		dst.set(k, mergeConfig(dst.table[k], src.table[k]))
+	}
+	return dst
+}
+
+// bindOrder returns the indexes of the flags of cmd in the order they are bound:
+// the flag naming the config file first, so that the file can be loaded for the other flags.
+func (cmd *command) bindOrder() []int {
+	order := make([]int, 0, len(cmd.Flags))
+	for i := range cmd.Flags {
+		if cmd.Flags[i].Config {
+			order = append(order, i)
+		}
+	}
+	for i := range cmd.Flags {
+		if !cmd.Flags[i].Config {
+			order = append(order, i)
+		}
+	}
+	return order
+}
+
+// configTable returns the table of cmd in the config file root, or nil.
+func (cmd *command) configTable(root *configValue) *configValue {
+	if cmd.Parent == nil {
+		return root
+	}
+	t := cmd.Parent.configTable(root).get(cmd.Command)
+	if t == nil || t.kind != configTable {
+		return nil
+	}
+	return t
+}
+
+// checkConfig reports the keys of the table t that are neither configurable flags nor subcommands of cmd,
+// and does the same for the tables of the subcommands. prefix is the dotted key of t.
+func (cmd *command) checkConfig(t *configValue, prefix string) Errors {
+	var errs Errors
+	for _, key := range t.keys {
+		v := t.table[key]
+		if i := cmd.flagIndex(key); i >= 0 {
+			if !cmd.Flags[i].Configurable {
+				errs = append(errs, &Error{
+					Kind:    KindConfig,
+					Command: cmd.path(),
+					Flag:    key,
+					msg:     fmt.Sprintf("%s: key %s can not be set in a config file", v.pos, strconv.Quote(prefix+key)),
+				})
+			}
+			continue
+		}
+		var sub *command
+		for j := range cmd.SubCommands {
+			if cmd.SubCommands[j].Command == key {
+				sub = &cmd.SubCommands[j]
+			}
+		}
+		switch {
+		case sub == nil:
+			errs = append(errs, &Error{
+				Kind:    KindConfig,
+				Command: cmd.path(),
+				msg:     fmt.Sprintf("%s: unknown key %s", v.pos, strconv.Quote(prefix+key)),
+			})
+		case v.kind != configTable:
+			errs = append(errs, &Error{
+				Kind:    KindConfig,
+				Command: sub.path(),
+				msg:     fmt.Sprintf("%s: key %s must be a table for the subcommand %s, got %s", v.pos, strconv.Quote(prefix+key), sub.Command, v.describe()),
+			})
+		default:
+			errs = append(errs, sub.checkConfig(v, prefix+key+".")...)
+		}
+	}
+	return errs
+}
+
+// configKey returns the dotted key of the flag name of cmd in a config file, e.g. "db.port".
+func (cmd *command) configKey(name string) string {
+	for c := cmd; c.Parent != nil; c = c.Parent {
+		name = c.Command + "." + name
+	}
+	return name
+}
+
+// applyConfig sets dst from the config value v like apply. Lists are only accepted by slice and array flags,
+// and tables by map flags.
+func (f *fieldMeta) applyConfig(dst reflect.Value, v *configValue, source valueSource) error {
+	switch v.kind {
+	case configTable:
+		values := make([]string, len(v.keys))
+		pairs := make([]string, len(v.keys))
+		for i, k := range v.keys {
+			e := v.table[k]
+			if e.kind != configScalar {
+				return f.configTypeError(e.describe()+" in a table", source)
+			}
+			values[i] = e.value
+			pairs[i] = k + " = " + strconv.Quote(e.value)
+		}
+		return f.applyWith(dst, strings.Join(pairs, ","), "{"+strings.Join(pairs, ", ")+"}", source, func() error {
+			return f.setMapValues(dst, v.keys, values)
+		})
+	case configScalar:
+		return f.apply(dst, v.value, source)
+	case configList:
+		values := make([]string, len(v.list))
+		quoted := make([]string, len(v.list))
+		for i, e := range v.list {
+			if e.kind != configScalar {
+				return f.configTypeError(e.describe()+" in a list", source)
+			}
+			values[i] = e.value
+			quoted[i] = strconv.Quote(e.value)
+		}
+		return f.applyWith(dst, strings.Join(values, ","), "["+strings.Join(quoted, ", ")+"]", source, func() error {
+			return f.setValues(dst, values)
+		})
+	}
+	return f.configTypeError(v.describe(), source)
+}
+
+// configTypeError reports a config value of the wrong shape for f, e.g. a table for an int flag.
+func (f *fieldMeta) configTypeError(got string, source valueSource) error {
+	return &Error{
+		Kind:       KindParse,
+		Flag:       f.Name,
+		Source:     source.kind,
+		SourceName: source.name,
+		msg:        fmt.Sprintf("can not parse %s as %s for --%s (from %s)", got, f.typeName(), f.Name, source),
+	}
+}
+
+// parseJSONConfig parses a JSON config file. The top level must be an object; null values are ignored.
+func parseJSONConfig(path string, data []byte) (*configValue, error) {
+	p := &jsonConfigParser{dec: json.NewDecoder(bytes.NewReader(data)), data: data, path: path}
+	p.dec.UseNumber()
+	v, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	if v == nil || v.kind != configTable {
+		return nil, configErrorf(path+":1", "expected an object at the top level")
+	}
+	if _, err := p.dec.Token(); err != io.EOF {
+		return nil, configErrorf(p.pos(), "unexpected data after the top-level object")
+	}
+	return v, nil
+}
+
+// jsonConfigParser reads JSON tokens into configValues, tracking their lines.
+type jsonConfigParser struct {
+	dec  *json.Decoder
+	data []byte
+	path string
+}
+
+// pos returns the position of the token read last.
+func (p *jsonConfigParser) pos() string {
+	return p.posAt(int(p.dec.InputOffset()) - 1)
+}
+
+func (p *jsonConfigParser) posAt(offset int) string {
+	if offset > len(p.data) {
+		offset = len(p.data)
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return fmt.Sprintf("%s:%d", p.path, 1+bytes.Count(p.data[:offset], []byte{'\n'}))
+}
+
+func (p *jsonConfigParser) token() (json.Token, error) {
+	tok, err := p.dec.Token()
+	if err != nil {
+		var se *json.SyntaxError
+		if errors.As(err, &se) {
+			return nil, configErrorf(p.posAt(int(se.Offset)-1), "%v", err)
+		}
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, configErrorf(p.posAt(len(p.data)), "%v", err)
+	}
+	return tok, nil
+}
+
+// value reads the next value. It returns nil for null.
+func (p *jsonConfigParser) value() (*configValue, error) {
+	tok, err := p.token()
+	if err != nil {
+		return nil, err
+	}
+	pos := p.pos()
+	switch t := tok.(type) {
+	case json.Delim:
+		if t == '[' {
+			v := &configValue{kind: configList, pos: pos}
+			for p.dec.More() {
+				e, err := p.value()
+				if err != nil {
+					return nil, err
+				}
+				if e != nil {
+					v.list = append(v.list, e)
+				}
+			}
+			_, err := p.token()
+			return v, err
+		}
+
+		v := newConfigTable(pos)
+		for p.dec.More() {
+			tok, err := p.token()
+			if err != nil {
+				return nil, err
+			}
+			key := tok.(string)
+			if _, ok := v.table[key]; ok {
+				return nil, configErrorf(p.pos(), "duplicate key %s", strconv.Quote(key))
+			}
+			e, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			if e != nil {
+				v.set(key, e)
+			}
+		}
+		_, err := p.token()
+		return v, err
+	case string:
+		return &configValue{value: t, pos: pos}, nil
+	case json.Number:
+		return &configValue{value: t.String(), pos: pos}, nil
+	case bool:
+		return &configValue{value: strconv.FormatBool(t), pos: pos}, nil
+	}
+	return nil, nil
+}
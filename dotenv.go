@@ -0,0 +1,268 @@
+package broccoli
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// ErrInvalidDotEnv is returned by NewApp when a dotenv file loaded with WithDotEnv can not be parsed.
+var ErrInvalidDotEnv = errors.New("broccoli: invalid dotenv file")
+
+// dotEnv holds the variables loaded from dotenv files.
+type dotEnv map[string]dotEnvValue
+
+// dotEnvValue is the value of a dotenv variable and the position it was defined at, e.g. ".env:3".
+type dotEnvValue struct {
+	value string
+	pos   string
+}
+
+// loadDotEnv reads the dotenv files paths in order, later files overriding earlier ones.
+// Missing files are skipped. References to other variables are resolved with lookup first,
+// then with the variables defined before them.
+func loadDotEnv(paths []string, lookup func(string) (string, bool)) (dotEnv, error) {
+	env := dotEnv{}
+	for _, p := range paths {
+		b, err := os.ReadFile(p)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("broccoli: %w", err)
+		}
+		s := &dotEnvScanner{src: strings.ReplaceAll(string(b), "\r\n", "\n"), path: p, line: 1, env: env, lookup: lookup}
+		if err := s.parse(); err != nil {
+			return nil, err
+		}
+	}
+	return env, nil
+}
+
+// lookup returns the value of the dotenv variable name and its source.
+func (env dotEnv) lookup(name string) (string, valueSource, bool) {
+	v, ok := env[name]
+	return v.value, valueSource{kind: SourceDotEnv, name: name, origin: v.pos}, ok
+}
+
+// dotEnvScanner parses a single dotenv file into env.
+type dotEnvScanner struct {
+	src    string
+	i      int
+	path   string
+	line   int
+	env    dotEnv
+	lookup func(string) (string, bool)
+}
+
+func (s *dotEnvScanner) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s:%d: %s", ErrInvalidDotEnv, s.path, s.line, fmt.Sprintf(format, args...))
+}
+
+func (s *dotEnvScanner) eof() bool {
+	return s.i >= len(s.src)
+}
+
+func (s *dotEnvScanner) skipBlanks() {
+	for !s.eof() && (s.src[s.i] == ' ' || s.src[s.i] == '\t') {
+		s.i++
+	}
+}
+
+// skipComment skips a comment up to the end of the line, if any, and reports whether the line ends there.
+func (s *dotEnvScanner) skipComment() bool {
+	s.skipBlanks()
+	if !s.eof() && s.src[s.i] == '#' {
+		for !s.eof() && s.src[s.i] != '\n' {
+			s.i++
+		}
+	}
+	return s.eof() || s.src[s.i] == '\n'
+}
+
+func (s *dotEnvScanner) parse() error {
+	for !s.eof() {
+		if s.skipComment() {
+			if !s.eof() {
+				s.i++
+				s.line++
+			}
+			continue
+		}
+		pos := fmt.Sprintf("%s:%d", s.path, s.line)
+
+		if strings.HasPrefix(s.src[s.i:], "export ") || strings.HasPrefix(s.src[s.i:], "export\t") {
+			s.i += len("export")
+			s.skipBlanks()
+		}
+		start := s.i
+		for !s.eof() && (isEnvNameByte(s.src[s.i], s.i == start) || s.i > start && s.src[s.i] == '.') {
+			s.i++
+		}
+		key := s.src[start:s.i]
+		if key == "" {
+			return s.errorf("expected a variable name")
+		}
+		s.skipBlanks()
+		if s.eof() || s.src[s.i] != '=' {
+			return s.errorf("expected = after %s", key)
+		}
+		s.i++
+		s.skipBlanks()
+
+		value, err := s.value()
+		if err != nil {
+			return err
+		}
+		s.env[key] = dotEnvValue{value: value, pos: pos}
+	}
+	return nil
+}
+
+// value reads a single-quoted, double-quoted or unquoted value and the rest of its line.
+func (s *dotEnvScanner) value() (string, error) {
+	if s.eof() {
+		return "", nil
+	}
+	switch s.src[s.i] {
+	case '\'':
+		// Single-quoted values are taken literally
+		end := strings.IndexByte(s.src[s.i+1:], '\'')
+		if end < 0 {
+			return "", s.errorf("unterminated quoted value")
+		}
+		value := s.src[s.i+1 : s.i+1+end]
+		s.line += strings.Count(value, "\n")
+		s.i += end + 2
+		if !s.skipComment() {
+			return "", s.errorf("unexpected text after quoted value")
+		}
+		return value, nil
+	case '"':
+		s.i++
+		var sb strings.Builder
+		start := s.line
+		for {
+			if s.eof() {
+				s.line = start
+				return "", s.errorf("unterminated quoted value")
+			}
+			c := s.src[s.i]
+			switch {
+			case c == '"':
+				s.i++
+				if !s.skipComment() {
+					return "", s.errorf("unexpected text after quoted value")
+				}
+				return sb.String(), nil
+			case c == '\\' && s.i+1 < len(s.src):
+				s.i += 2
+				switch e := s.src[s.i-1]; e {
+				case 'n':
+					sb.WriteByte('\n')
+				case 'r':
+					sb.WriteByte('\r')
+				case 't':
+					sb.WriteByte('\t')
+				case '"', '\\', '$':
+					sb.WriteByte(e)
+				default:
+					sb.WriteByte('\\')
+					sb.WriteByte(e)
+				}
+			case c == '$':
+				if err := s.expand(&sb); err != nil {
+					return "", err
+				}
+			default:
+				if c == '\n' {
+					s.line++
+				}
+				sb.WriteByte(c)
+				s.i++
+			}
+		}
+	}
+
+	// Unquoted values end at the end of the line or at a comment preceded by a blank
+	var sb strings.Builder
+	for !s.eof() && s.src[s.i] != '\n' {
+		c := s.src[s.i]
+		if c == '#' && s.i > 0 && (s.src[s.i-1] == ' ' || s.src[s.i-1] == '\t') {
+			s.skipComment()
+			break
+		}
+		if c == '$' {
+			if err := s.expand(&sb); err != nil {
+				return "", err
+			}
+			continue
+		}
+		sb.WriteByte(c)
+		s.i++
+	}
+	return strings.TrimRight(sb.String(), " \t"), nil
+}
+
+// expand writes the value of the reference $NAME, ${NAME} or ${NAME:-default} at the current position to sb.
+// A $ that does not start a reference is written as is.
+func (s *dotEnvScanner) expand(sb *strings.Builder) error {
+	s.i++
+	braced := !s.eof() && s.src[s.i] == '{'
+	if braced {
+		s.i++
+	}
+	start := s.i
+	for !s.eof() && isEnvNameByte(s.src[s.i], s.i == start) {
+		s.i++
+	}
+	name := s.src[start:s.i]
+	if !braced {
+		if name == "" {
+			sb.WriteByte('$')
+			return nil
+		}
+		sb.WriteString(s.resolve(name))
+		return nil
+	}
+
+	end := strings.IndexByte(s.src[s.i:], '}')
+	if name == "" || end < 0 || strings.Contains(s.src[s.i:s.i+end], "\n") {
+		return s.errorf("invalid variable reference")
+	}
+	rest := s.src[s.i : s.i+end]
+	s.i += end + 1
+	value := s.resolve(name)
+	switch {
+	case rest == "":
+	case strings.HasPrefix(rest, ":-"):
+		if value == "" {
+			value = rest[2:]
+		}
+	default:
+		return s.errorf("invalid variable reference")
+	}
+	sb.WriteString(value)
+	return nil
+}
+
+// resolve returns the value of the variable name from the environment or the dotenv variables defined so far.
+func (s *dotEnvScanner) resolve(name string) string {
+	if v, ok := s.lookup(name); ok {
+		return v
+	}
+	return s.env[name].value
+}
+
+// isEnvNameByte reports whether c may appear in a variable name, at its start if first is true.
+func isEnvNameByte(c byte, first bool) bool {
+	switch {
+	case c == '_', 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+		return true
+	case '0' <= c && c <= '9':
+		return !first
+	}
+	return false
+}
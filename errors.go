@@ -0,0 +1,264 @@
+package broccoli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrMissingValue is returned when a flag that takes a value is the last argument.
+var ErrMissingValue = errors.New("broccoli: missing value")
+
+// ErrInvalidValue is returned when a value does not satisfy the constraints of a flag,
+// e.g. choices, min/max, min_len/max_len, pattern or path.
+var ErrInvalidValue = errors.New("broccoli: invalid value")
+
+// ErrConflict is returned when several flags of a mutually exclusive group are set.
+var ErrConflict = errors.New("broccoli: conflicting flags")
+
+// ErrValidation is returned when the Validate method of a command struct fails.
+var ErrValidation = errors.New("broccoli: validation failed")
+
+// ErrConfig is returned when a config file can not be read or parsed, or contains keys that are not flags or subcommands.
+var ErrConfig = errors.New("broccoli: invalid config file")
+
+// ErrorKind classifies an Error.
+type ErrorKind int
+
+const (
+	// KindParse means a value can not be converted to the type of its flag. It matches ErrTypeMismatch.
+	KindParse ErrorKind = iota + 1
+	// KindMissingValue means a flag was given without its value. It matches ErrMissingValue.
+	KindMissingValue
+	// KindMissingRequired means a required flag or group is not set. It matches ErrMissingRequiredField.
+	KindMissingRequired
+	// KindInvalidValue means a value violates a constraint of its flag. It matches ErrInvalidValue.
+	KindInvalidValue
+	// KindConflict means mutually exclusive flags are set together. It matches ErrConflict.
+	KindConflict
+	// KindValidation means the Validate method of a command struct failed. It matches ErrValidation.
+	KindValidation
+	// KindConfig means a config file can not be read or parsed, or has an unknown key. It matches ErrConfig.
+	KindConfig
+)
+
+var kindNames = map[ErrorKind]string{
+	KindParse:           "parse",
+	KindMissingValue:    "missing_value",
+	KindMissingRequired: "missing_required",
+	KindInvalidValue:    "invalid_value",
+	KindConflict:        "conflict",
+	KindValidation:      "validation",
+	KindConfig:          "config",
+}
+
+var kindSentinels = map[ErrorKind]error{
+	KindParse:           ErrTypeMismatch,
+	KindMissingValue:    ErrMissingValue,
+	KindMissingRequired: ErrMissingRequiredField,
+	KindInvalidValue:    ErrInvalidValue,
+	KindConflict:        ErrConflict,
+	KindValidation:      ErrValidation,
+	KindConfig:          ErrConfig,
+}
+
+func (k ErrorKind) String() string {
+	if name, ok := kindNames[k]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// Source tells where the value of a flag came from.
+type Source string
+
+const (
+	SourceArg     Source = "arg"
+	SourceEnv     Source = "env"
+	SourceDotEnv  Source = "dotenv"
+	SourceConfig  Source = "config"
+	SourceDefault Source = "default"
+)
+
+// valueSource is a Source together with the name of the variable it was read from, if any,
+// the position it was defined at for dotenv variables and config keys, and the file holding the value for
+// NAME_FILE variables. For config files, name is the dotted key, e.g. "db.port".
+type valueSource struct {
+	kind   Source
+	name   string
+	origin string
+	file   string
+}
+
+// set reports whether the flag got a value.
+func (s valueSource) set() bool {
+	return s.kind != ""
+}
+
+// String describes the source for error messages, e.g. "argument" or "env PORT".
+func (s valueSource) String() string {
+	switch s.kind {
+	case SourceArg:
+		return "argument"
+	case SourceEnv, SourceDotEnv:
+		if s.file != "" {
+			return "file " + s.file
+		}
+		if s.origin != "" {
+			return "env " + s.name + " in " + s.origin
+		}
+		return "env " + s.name
+	case SourceConfig:
+		return "config key " + s.name + " at " + s.origin
+	case SourceDefault:
+		return "default value"
+	}
+	return string(s.kind)
+}
+
+// Error describes a failure to bind a flag or command.
+// It matches the sentinel error of its Kind with errors.Is, and unwraps to the underlying cause, if any.
+type Error struct {
+	Kind ErrorKind
+	// Command is the path of the command, e.g. "app db migrate".
+	Command string
+	// Flag is the name of the flag without dashes. It is empty for errors that concern several flags.
+	Flag string
+	// Value is the raw value that failed to bind.
+	Value string
+	// Source is where Value came from.
+	Source Source
+	// SourceName is the name of the environment variable Value was read from, if any.
+	SourceName string
+	// Err is the underlying cause, e.g. the error returned by Validate.
+	Err error
+
+	msg      string
+	exitCode int
+}
+
+func (e *Error) Error() string {
+	return e.msg
+}
+
+// Unwrap returns the underlying cause.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the sentinel error of the kind of e.
+func (e *Error) Is(target error) bool {
+	return target != nil && kindSentinels[e.Kind] == target
+}
+
+// Errors is a list of errors reported together, e.g. by an App created with WithAllErrors.
+type Errors []error
+
+// Error joins the messages of all errors.
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i := range e {
+		msgs[i] = e[i].Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the individual errors.
+func (e Errors) Unwrap() []error {
+	return e
+}
+
+// Is reports whether any of the errors matches target.
+func (e Errors) Is(target error) bool {
+	for i := range e {
+		if errors.Is(e[i], target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first error that matches target.
+func (e Errors) As(target interface{}) bool {
+	for i := range e {
+		if errors.As(e[i], target) {
+			return true
+		}
+	}
+	return false
+}
+
+// result returns nil for an empty list, the list itself if all is set, and the first error otherwise.
+func (e Errors) result(all bool) error {
+	if len(e) == 0 {
+		return nil
+	}
+	if all {
+		return e
+	}
+	return e[0]
+}
+
+// ExitUsage is the exit status for usage errors defined by BSD sysexits (EX_USAGE).
+// Pass it to WithUsageExitCode to use it instead of the default status 2.
+const ExitUsage = 64
+
+// defaultUsageExitCode is the exit status for usage errors unless an App overrides it.
+const defaultUsageExitCode = 2
+
+// ExitCoder is implemented by errors that choose the exit status of the program.
+type ExitCoder interface {
+	ExitCode() int
+}
+
+// ExitCode returns the exit status of a usage error, 2 unless changed with WithUsageExitCode.
+// If the underlying cause implements ExitCoder, e.g. an error returned by Validate, its status is returned
+// instead. Other validation errors exit with 1.
+func (e *Error) ExitCode() int {
+	var ec ExitCoder
+	if errors.As(e.Err, &ec) {
+		return ec.ExitCode()
+	}
+	if e.Kind == KindValidation {
+		return 1
+	}
+	if e.exitCode != 0 {
+		return e.exitCode
+	}
+	return defaultUsageExitCode
+}
+
+// ExitCode returns the exit status of the first error that implements ExitCoder, or 1.
+func (e Errors) ExitCode() int {
+	for i := range e {
+		var ec ExitCoder
+		if errors.As(e[i], &ec) {
+			return ec.ExitCode()
+		}
+	}
+	return 1
+}
+
+// ExitCode maps err to an exit status.
+// nil and ErrHelp map to 0, errors implementing ExitCoder (including binding errors) to their own status,
+// and any other error to 1.
+func ExitCode(err error) int {
+	if err == nil || errors.Is(err, ErrHelp) {
+		return 0
+	}
+	var ec ExitCoder
+	if errors.As(err, &ec) {
+		return ec.ExitCode()
+	}
+	return 1
+}
+
+// Exit terminates the program with the exit status ExitCode returns for err.
+// A non-nil err other than ErrHelp is printed to stderr first.
+func Exit(err error) {
+	if err != nil && !errors.Is(err, ErrHelp) {
+		fmt.Fprintln(os.Stderr, err.Error())
+	}
+	os.Exit(ExitCode(err))
+}
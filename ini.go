@@ -0,0 +1,101 @@
+package broccoli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseINIConfig parses an INI config file. Keys before the first section belong to the root command, and
+// a [section] header selects a subcommand by its dotted path, e.g. [db.migrate], or a map flag. Repeated
+// keys make a list for slice flags. Lines starting with ; or # are comments, as is the rest of an unquoted
+// value after a blank followed by ; or #. Values enclosed in matching quotes are taken literally.
+func parseINIConfig(path string, data []byte) (*configValue, error) {
+	root := newConfigTable(path + ":1")
+	section, name := root, ""
+	for i, line := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		pos := fmt.Sprintf("%s:%d", path, i+1)
+		line = strings.TrimSpace(line)
+		if i == 0 {
+			line = strings.TrimPrefix(line, "\uFEFF")
+		}
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+
+		if line[0] == '[' {
+			end := strings.IndexByte(line, ']')
+			if end < 0 {
+				return nil, configErrorf(pos, "expected ] after the section name")
+			}
+			if rest := strings.TrimSpace(line[end+1:]); rest != "" && rest[0] != ';' && rest[0] != '#' {
+				return nil, configErrorf(pos, "unexpected %s after the section", strconv.Quote(rest))
+			}
+			name = strings.TrimSpace(line[1:end])
+			if name == "" {
+				return nil, configErrorf(pos, "expected a section name")
+			}
+			// Sections are created along their path, and a repeated section adds to the same table
+			section = root
+			for _, k := range strings.Split(name, ".") {
+				k = strings.TrimSpace(k)
+				v := section.table[k]
+				switch {
+				case k == "":
+					return nil, configErrorf(pos, "invalid section name %s", strconv.Quote(name))
+				case v == nil:
+					v = newConfigTable(pos)
+					section.set(k, v)
+				case v.kind != configTable:
+					return nil, configErrorf(pos, "section %s is already defined as a key", strconv.Quote(name))
+				}
+				section = v
+			}
+			continue
+		}
+
+		sep := strings.IndexAny(line, "=:")
+		if sep < 0 {
+			return nil, configErrorf(pos, "expected key = value")
+		}
+		if eq := strings.IndexByte(line, '='); eq >= 0 {
+			sep = eq
+		}
+		key := strings.TrimSpace(line[:sep])
+		if key == "" {
+			return nil, configErrorf(pos, "expected a key before %c", line[sep])
+		}
+		value := iniValue(strings.TrimSpace(line[sep+1:]))
+
+		v := &configValue{value: value, pos: pos}
+		switch prev := section.table[key]; {
+		case prev == nil:
+			section.set(key, v)
+		case prev.kind == configScalar:
+			// A repeated key makes a list
+			section.set(key, &configValue{kind: configList, list: []*configValue{prev, v}, pos: prev.pos})
+		case prev.kind == configList:
+			prev.list = append(prev.list, v)
+		default:
+			full := key
+			if name != "" {
+				full = name + "." + key
+			}
+			return nil, configErrorf(pos, "key %s is already defined as a section", strconv.Quote(full))
+		}
+	}
+	return root, nil
+}
+
+// iniValue removes the quotes around a value, or an inline comment from an unquoted value.
+func iniValue(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	for i := 1; i < len(s); i++ {
+		if (s[i] == ';' || s[i] == '#') && (s[i-1] == ' ' || s[i-1] == '\t') {
+			return strings.TrimRight(s[:i], " \t")
+		}
+	}
+	return s
+}
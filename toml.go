@@ -0,0 +1,577 @@
+package broccoli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// parseTOMLConfig parses a TOML config file. Tables map to subcommands, arrays to slice flags and
+// inline tables to map flags. Numbers, booleans and date-times are kept in their text form, with
+// underscores removed from numbers, and converted by the flags they are bound to.
+func parseTOMLConfig(path string, data []byte) (*configValue, error) {
+	p := &tomlParser{
+		src:      strings.ReplaceAll(string(data), "\r\n", "\n"),
+		path:     path,
+		line:     1,
+		root:     newConfigTable(path + ":1"),
+		explicit: map[*configValue]bool{},
+		closed:   map[*configValue]bool{},
+	}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	return p.root, nil
+}
+
+// tomlParser reads a TOML document into a configValue tree.
+type tomlParser struct {
+	src  string
+	i    int
+	path string
+	line int
+
+	root *configValue
+	// explicit holds the tables defined by a [table] header, which can not be defined again.
+	explicit map[*configValue]bool
+	// closed holds the inline tables and arrays, which can not be extended.
+	closed map[*configValue]bool
+}
+
+func (p *tomlParser) pos() string {
+	return fmt.Sprintf("%s:%d", p.path, p.line)
+}
+
+func (p *tomlParser) errorf(format string, args ...interface{}) error {
+	return configErrorf(p.pos(), format, args...)
+}
+
+func (p *tomlParser) eof() bool {
+	return p.i >= len(p.src)
+}
+
+func (p *tomlParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.i]
+}
+
+// skipBlanks skips spaces and tabs.
+func (p *tomlParser) skipBlanks() {
+	for !p.eof() && (p.src[p.i] == ' ' || p.src[p.i] == '\t') {
+		p.i++
+	}
+}
+
+// skipLines skips blanks, comments and newlines.
+func (p *tomlParser) skipLines() {
+	for {
+		p.skipBlanks()
+		switch p.peek() {
+		case '#':
+			for !p.eof() && p.src[p.i] != '\n' {
+				p.i++
+			}
+		case '\n':
+			p.i++
+			p.line++
+		default:
+			return
+		}
+	}
+}
+
+// endOfLine checks that only blanks and a comment follow on the current line.
+func (p *tomlParser) endOfLine() error {
+	p.skipBlanks()
+	if p.peek() == '#' {
+		for !p.eof() && p.src[p.i] != '\n' {
+			p.i++
+		}
+	}
+	if !p.eof() && p.src[p.i] != '\n' {
+		return p.errorf("unexpected %s at the end of the line", strconv.Quote(string(p.src[p.i])))
+	}
+	return nil
+}
+
+func (p *tomlParser) parse() error {
+	current := p.root
+	for {
+		p.skipLines()
+		if p.eof() {
+			return nil
+		}
+		if p.peek() != '[' {
+			if err := p.keyValue(current); err != nil {
+				return err
+			}
+		} else {
+			var err error
+			if current, err = p.header(); err != nil {
+				return err
+			}
+		}
+		if err := p.endOfLine(); err != nil {
+			return err
+		}
+	}
+}
+
+// header reads a [table] or [[array of tables]] header and returns the table it opens.
+func (p *tomlParser) header() (*configValue, error) {
+	pos := p.pos()
+	array := strings.HasPrefix(p.src[p.i:], "[[")
+	if array {
+		p.i += 2
+	} else {
+		p.i++
+	}
+	p.skipBlanks()
+	keys, err := p.key()
+	if err != nil {
+		return nil, err
+	}
+	p.skipBlanks()
+	if array {
+		if !strings.HasPrefix(p.src[p.i:], "]]") {
+			return nil, p.errorf("expected ]] after the table name")
+		}
+		p.i += 2
+	} else {
+		if p.peek() != ']' {
+			return nil, p.errorf("expected ] after the table name")
+		}
+		p.i++
+	}
+
+	parent, err := p.table(p.root, keys[:len(keys)-1], pos)
+	if err != nil {
+		return nil, err
+	}
+	last := keys[len(keys)-1]
+	v := parent.table[last]
+	name := strings.Join(keys, ".")
+	if array {
+		switch {
+		case v == nil:
+			v = &configValue{kind: configList, pos: pos}
+			parent.set(last, v)
+		case v.kind != configList || p.closed[v]:
+			return nil, p.errorf("key %s is already defined", strconv.Quote(name))
+		}
+		t := newConfigTable(pos)
+		v.list = append(v.list, t)
+		return t, nil
+	}
+	switch {
+	case v == nil:
+		v = newConfigTable(pos)
+		parent.set(last, v)
+	case v.kind != configTable || p.explicit[v] || p.closed[v]:
+		return nil, p.errorf("table %s is already defined", strconv.Quote(name))
+	}
+	p.explicit[v] = true
+	return v, nil
+}
+
+// table walks down the dotted key keys from t, creating the missing tables.
+// A key naming an array of tables continues in its last table.
+func (p *tomlParser) table(t *configValue, keys []string, pos string) (*configValue, error) {
+	for i, k := range keys {
+		v := t.table[k]
+		switch {
+		case v == nil:
+			v = newConfigTable(pos)
+			t.set(k, v)
+		case v.kind == configList && !p.closed[v] && len(v.list) > 0:
+			v = v.list[len(v.list)-1]
+		case v.kind != configTable || p.closed[v]:
+			return nil, p.errorf("key %s is already defined", strconv.Quote(strings.Join(keys[:i+1], ".")))
+		}
+		t = v
+	}
+	return t, nil
+}
+
+// keyValue reads a key = value pair into the table t.
+func (p *tomlParser) keyValue(t *configValue) error {
+	pos := p.pos()
+	keys, err := p.key()
+	if err != nil {
+		return err
+	}
+	p.skipBlanks()
+	if p.peek() != '=' {
+		return p.errorf("expected = after the key %s", strconv.Quote(strings.Join(keys, ".")))
+	}
+	p.i++
+	p.skipBlanks()
+	v, err := p.value(pos)
+	if err != nil {
+		return err
+	}
+	parent, err := p.table(t, keys[:len(keys)-1], pos)
+	if err != nil {
+		return err
+	}
+	last := keys[len(keys)-1]
+	if _, ok := parent.table[last]; ok {
+		return configErrorf(pos, "key %s is already defined", strconv.Quote(strings.Join(keys, ".")))
+	}
+	parent.set(last, v)
+	return nil
+}
+
+// key reads a dotted key of bare and quoted parts.
+func (p *tomlParser) key() ([]string, error) {
+	var keys []string
+	for {
+		p.skipBlanks()
+		var k string
+		switch c := p.peek(); {
+		case c == '"':
+			s, err := p.basicString()
+			if err != nil {
+				return nil, err
+			}
+			k = s
+		case c == '\'':
+			s, err := p.literalString()
+			if err != nil {
+				return nil, err
+			}
+			k = s
+		default:
+			start := p.i
+			for !p.eof() && isTOMLBareKeyByte(p.src[p.i]) {
+				p.i++
+			}
+			if p.i == start {
+				return nil, p.errorf("expected a key")
+			}
+			k = p.src[start:p.i]
+		}
+		keys = append(keys, k)
+		p.skipBlanks()
+		if p.peek() != '.' {
+			return keys, nil
+		}
+		p.i++
+	}
+}
+
+func isTOMLBareKeyByte(c byte) bool {
+	return c == '_' || c == '-' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+// value reads a value defined at pos.
+func (p *tomlParser) value(pos string) (*configValue, error) {
+	switch c := p.peek(); {
+	case strings.HasPrefix(p.src[p.i:], `"""`):
+		s, err := p.multiLineBasicString()
+		return &configValue{value: s, pos: pos}, err
+	case c == '"':
+		s, err := p.basicString()
+		return &configValue{value: s, pos: pos}, err
+	case strings.HasPrefix(p.src[p.i:], "'''"):
+		s, err := p.multiLineLiteralString()
+		return &configValue{value: s, pos: pos}, err
+	case c == '\'':
+		s, err := p.literalString()
+		return &configValue{value: s, pos: pos}, err
+	case c == '[':
+		return p.array(pos)
+	case c == '{':
+		return p.inlineTable(pos)
+	}
+	return p.scalar(pos)
+}
+
+// array reads an array, which may span several lines.
+func (p *tomlParser) array(pos string) (*configValue, error) {
+	p.i++
+	v := &configValue{kind: configList, pos: pos}
+	p.closed[v] = true
+	for {
+		p.skipLines()
+		if p.peek() == ']' {
+			p.i++
+			return v, nil
+		}
+		e, err := p.value(p.pos())
+		if err != nil {
+			return nil, err
+		}
+		v.list = append(v.list, e)
+		p.skipLines()
+		switch p.peek() {
+		case ',':
+			p.i++
+		case ']':
+		default:
+			return nil, p.errorf("expected , or ] in array")
+		}
+	}
+}
+
+// inlineTable reads an inline table on a single line.
+func (p *tomlParser) inlineTable(pos string) (*configValue, error) {
+	p.i++
+	v := newConfigTable(pos)
+	p.skipBlanks()
+	if p.peek() == '}' {
+		p.i++
+		p.closed[v] = true
+		return v, nil
+	}
+	for {
+		p.skipBlanks()
+		if err := p.keyValue(v); err != nil {
+			return nil, err
+		}
+		p.skipBlanks()
+		switch p.peek() {
+		case ',':
+			p.i++
+		case '}':
+			p.i++
+			p.closed[v] = true
+			return v, nil
+		default:
+			return nil, p.errorf("expected , or } in inline table")
+		}
+	}
+}
+
+// scalar reads a boolean, number or date-time.
+func (p *tomlParser) scalar(pos string) (*configValue, error) {
+	start := p.i
+	for !p.eof() && !strings.ContainsRune(" \t\n,]}#", rune(p.src[p.i])) {
+		p.i++
+	}
+	s := p.src[start:p.i]
+	// A date-time may separate the date and the time with a space
+	if isTOMLDate(s) && p.i+3 < len(p.src) && p.src[p.i] == ' ' && isDigit(p.src[p.i+1]) && isDigit(p.src[p.i+2]) && p.src[p.i+3] == ':' {
+		p.i++
+		for !p.eof() && !strings.ContainsRune(" \t\n,]}#", rune(p.src[p.i])) {
+			p.i++
+		}
+		s = s + "T" + p.src[start+len(s)+1:p.i]
+	}
+	switch {
+	case s == "":
+		return nil, p.errorf("expected a value")
+	case s == "true" || s == "false":
+	case isTOMLDate(s):
+		if len(s) > 10 && (s[10] == 't' || s[10] == ' ') {
+			s = s[:10] + "T" + s[11:]
+		}
+	case isTOMLNumber(s):
+		s = strings.ReplaceAll(s, "_", "")
+	default:
+		return nil, p.errorf("invalid value %s", strconv.Quote(s))
+	}
+	return &configValue{value: s, pos: pos}, nil
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// isTOMLDate reports whether s starts with a date (YYYY-MM-DD) or is a local time (HH:MM:SS).
+func isTOMLDate(s string) bool {
+	if len(s) >= 10 && isDigit(s[0]) && isDigit(s[1]) && isDigit(s[2]) && isDigit(s[3]) && s[4] == '-' && s[7] == '-' {
+		return true
+	}
+	return len(s) >= 8 && isDigit(s[0]) && isDigit(s[1]) && s[2] == ':' && s[5] == ':'
+}
+
+// isTOMLNumber reports whether s is a TOML integer or float, including inf and nan.
+func isTOMLNumber(s string) bool {
+	t := strings.TrimLeft(s, "+-")
+	if len(s)-len(t) > 1 {
+		return false
+	}
+	switch t {
+	case "inf", "nan":
+		return true
+	case "":
+		return false
+	}
+	if len(t) > 2 && t[0] == '0' && strings.ContainsRune("xob", rune(t[1])) {
+		if s != t {
+			return false
+		}
+		for _, c := range t[2:] {
+			if !(c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+				return false
+			}
+		}
+		return true
+	}
+	if !isDigit(t[0]) || strings.HasPrefix(t, "_") || strings.HasSuffix(t, "_") || strings.Contains(t, "__") {
+		return false
+	}
+	_, err := strconv.ParseFloat(strings.ReplaceAll(t, "_", ""), 64)
+	return err == nil || strings.Contains(err.Error(), "value out of range")
+}
+
+// basicString reads a "basic string" with escapes.
+func (p *tomlParser) basicString() (string, error) {
+	p.i++
+	var sb strings.Builder
+	for {
+		if p.eof() || p.src[p.i] == '\n' {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.src[p.i]
+		switch c {
+		case '"':
+			p.i++
+			return sb.String(), nil
+		case '\\':
+			if err := p.escape(&sb); err != nil {
+				return "", err
+			}
+		default:
+			sb.WriteByte(c)
+			p.i++
+		}
+	}
+}
+
+// multiLineBasicString reads a """multi-line basic string""". A newline right after the opening
+// delimiter is trimmed, and a backslash at the end of a line trims the following whitespace.
+func (p *tomlParser) multiLineBasicString() (string, error) {
+	p.i += 3
+	start := p.line
+	if p.peek() == '\n' {
+		p.i++
+		p.line++
+	}
+	var sb strings.Builder
+	for {
+		if p.eof() {
+			p.line = start
+			return "", p.errorf("unterminated string")
+		}
+		if strings.HasPrefix(p.src[p.i:], `"""`) {
+			// Up to two quotes may directly precede the closing delimiter
+			n := 3
+			for n < 5 && p.i+n < len(p.src) && p.src[p.i+n] == '"' {
+				n++
+			}
+			sb.WriteString(strings.Repeat(`"`, n-3))
+			p.i += n
+			return sb.String(), nil
+		}
+		c := p.src[p.i]
+		switch {
+		case c == '\\' && p.lineEndingBackslash():
+			p.i++
+			for !p.eof() && strings.ContainsRune(" \t\n", rune(p.src[p.i])) {
+				if p.src[p.i] == '\n' {
+					p.line++
+				}
+				p.i++
+			}
+		case c == '\\':
+			if err := p.escape(&sb); err != nil {
+				return "", err
+			}
+		default:
+			if c == '\n' {
+				p.line++
+			}
+			sb.WriteByte(c)
+			p.i++
+		}
+	}
+}
+
+// lineEndingBackslash reports whether the backslash at the current position is followed by blanks up to a newline.
+func (p *tomlParser) lineEndingBackslash() bool {
+	j := p.i + 1
+	for j < len(p.src) && (p.src[j] == ' ' || p.src[j] == '\t') {
+		j++
+	}
+	return j < len(p.src) && p.src[j] == '\n'
+}
+
+// escape writes the escape sequence at the current position to sb.
+func (p *tomlParser) escape(sb *strings.Builder) error {
+	if p.i+1 >= len(p.src) {
+		return p.errorf("unterminated string")
+	}
+	c := p.src[p.i+1]
+	p.i += 2
+	switch c {
+	case 'b':
+		sb.WriteByte('\b')
+	case 't':
+		sb.WriteByte('\t')
+	case 'n':
+		sb.WriteByte('\n')
+	case 'f':
+		sb.WriteByte('\f')
+	case 'r':
+		sb.WriteByte('\r')
+	case 'e':
+		sb.WriteByte(0x1b)
+	case '"', '\\':
+		sb.WriteByte(c)
+	case 'u', 'U':
+		n := 4
+		if c == 'U' {
+			n = 8
+		}
+		if p.i+n > len(p.src) {
+			return p.errorf("invalid escape sequence")
+		}
+		r, err := strconv.ParseUint(p.src[p.i:p.i+n], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(r)) {
+			return p.errorf("invalid escape sequence \\%c%s", c, p.src[p.i:p.i+n])
+		}
+		sb.WriteRune(rune(r))
+		p.i += n
+	default:
+		return p.errorf("invalid escape sequence \\%c", c)
+	}
+	return nil
+}
+
+// literalString reads a 'literal string' without escapes.
+func (p *tomlParser) literalString() (string, error) {
+	p.i++
+	end := strings.IndexAny(p.src[p.i:], "'\n")
+	if end < 0 || p.src[p.i+end] != '\'' {
+		return "", p.errorf("unterminated string")
+	}
+	s := p.src[p.i : p.i+end]
+	p.i += end + 1
+	return s, nil
+}
+
+// multiLineLiteralString reads a multi-line literal string delimited by three single quotes.
+func (p *tomlParser) multiLineLiteralString() (string, error) {
+	p.i += 3
+	if p.peek() == '\n' {
+		p.i++
+		p.line++
+	}
+	end := strings.Index(p.src[p.i:], "'''")
+	if end < 0 {
+		return "", p.errorf("unterminated string")
+	}
+	// Up to two quotes may directly precede the closing delimiter
+	for n := 0; n < 2 && p.i+end+3 < len(p.src) && p.src[p.i+end+3] == '\''; n++ {
+		end++
+	}
+	s := p.src[p.i : p.i+end]
+	p.line += strings.Count(s, "\n")
+	p.i += end + 3
+	return s, nil
+}
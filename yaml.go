@@ -0,0 +1,523 @@
+package broccoli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// parseYAMLConfig parses a config file in the YAML subset documented in the README: block mappings and
+// sequences, flow sequences and mappings on a single line, plain, quoted and block scalars, and comments.
+// Anchors, aliases, tags, complex keys and multiple documents are rejected. Null values are ignored and
+// other scalars are kept in their text form, to be converted by the flags they are bound to.
+func parseYAMLConfig(path string, data []byte) (*configValue, error) {
+	p := &yamlParser{path: path}
+	for i, raw := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		text := strings.TrimLeft(raw, " ")
+		p.lines = append(p.lines, yamlLine{num: i + 1, indent: len(raw) - len(text), text: yamlStripComment(text), raw: raw})
+	}
+
+	// A document may start with --- and end with ...
+	p.skipBlank()
+	if p.i < len(p.lines) && p.lines[p.i].indent == 0 && (p.lines[p.i].text == "---" || strings.HasPrefix(p.lines[p.i].text, "--- ")) {
+		p.lines[p.i].text = strings.TrimSpace(p.lines[p.i].text[3:])
+		if p.lines[p.i].text == "" {
+			p.i++
+		}
+	}
+	for j := p.i; j < len(p.lines); j++ {
+		if l := p.lines[j]; l.indent == 0 && (l.text == "---" || l.text == "...") {
+			if l.text == "---" {
+				return nil, p.errorf(l, "multiple documents are not supported")
+			}
+			p.lines = p.lines[:j]
+		}
+	}
+
+	v, err := p.node(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.skipBlank(); p.i < len(p.lines) {
+		return nil, p.errorf(p.lines[p.i], "unexpected indentation")
+	}
+	if v == nil {
+		return newConfigTable(path + ":1"), nil
+	}
+	if v.kind != configTable {
+		return nil, configErrorf(v.pos, "expected a mapping at the top level")
+	}
+	return v, nil
+}
+
+// yamlLine is a line of a YAML file. text is the content without indentation and comment.
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+	raw    string
+}
+
+// checkIndent rejects tabs in the indentation of the line l. Tabs are allowed in the content of block scalars,
+// which do not go through this check.
+func (p *yamlParser) checkIndent(l yamlLine) error {
+	if strings.HasPrefix(l.text, "\t") {
+		return p.errorf(l, "tabs can not be used for indentation")
+	}
+	return nil
+}
+
+// yamlParser reads the lines of a YAML document into a configValue tree.
+type yamlParser struct {
+	path  string
+	lines []yamlLine
+	i     int
+}
+
+func (p *yamlParser) pos(l yamlLine) string {
+	return fmt.Sprintf("%s:%d", p.path, l.num)
+}
+
+func (p *yamlParser) errorf(l yamlLine, format string, args ...interface{}) error {
+	return configErrorf(p.pos(l), format, args...)
+}
+
+// skipBlank skips the lines without content.
+func (p *yamlParser) skipBlank() {
+	for p.i < len(p.lines) && p.lines[p.i].text == "" {
+		p.i++
+	}
+}
+
+// node reads the block node starting at the current line, if it is indented by at least indent.
+// It returns nil for an empty node.
+func (p *yamlParser) node(indent int) (*configValue, error) {
+	p.skipBlank()
+	if p.i >= len(p.lines) || p.lines[p.i].indent < indent {
+		return nil, nil
+	}
+	l := p.lines[p.i]
+	if err := p.checkIndent(l); err != nil {
+		return nil, err
+	}
+	if isYAMLSequenceItem(l.text) {
+		return p.sequence(l.indent)
+	}
+	if _, _, ok, err := p.splitEntry(l); err != nil {
+		return nil, err
+	} else if ok {
+		return p.mapping(l.indent)
+	}
+	p.i++
+	return p.inline(l, l.text)
+}
+
+// mapping reads the entries of a block mapping indented by indent.
+func (p *yamlParser) mapping(indent int) (*configValue, error) {
+	t := newConfigTable(p.pos(p.lines[p.i]))
+	for {
+		p.skipBlank()
+		if p.i >= len(p.lines) || p.lines[p.i].indent < indent {
+			return t, nil
+		}
+		l := p.lines[p.i]
+		if err := p.checkIndent(l); err != nil {
+			return nil, err
+		}
+		if l.indent > indent {
+			return nil, p.errorf(l, "unexpected indentation")
+		}
+		key, rest, ok, err := p.splitEntry(l)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			if isYAMLSequenceItem(l.text) {
+				return nil, p.errorf(l, "unexpected sequence item in a mapping")
+			}
+			return nil, p.errorf(l, "expected a key")
+		}
+		if _, ok := t.table[key]; ok {
+			return nil, p.errorf(l, "duplicate key %s", strconv.Quote(key))
+		}
+		p.i++
+
+		var v *configValue
+		switch {
+		case rest == "":
+			// The value is the following block, which may be a sequence at the same indentation
+			p.skipBlank()
+			if p.i < len(p.lines) && p.lines[p.i].indent == indent && isYAMLSequenceItem(p.lines[p.i].text) {
+				v, err = p.sequence(indent)
+			} else {
+				v, err = p.node(indent + 1)
+			}
+		case rest[0] == '|' || rest[0] == '>':
+			v, err = p.blockScalar(l, rest, indent)
+		default:
+			v, err = p.inline(l, rest)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if v != nil {
+			// Values are reported at the line of their key
+			v.pos = p.pos(l)
+			t.set(key, v)
+		}
+	}
+}
+
+// sequence reads the items of a block sequence indented by indent.
+func (p *yamlParser) sequence(indent int) (*configValue, error) {
+	v := &configValue{kind: configList, pos: p.pos(p.lines[p.i])}
+	for {
+		p.skipBlank()
+		if p.i >= len(p.lines) || p.lines[p.i].indent < indent {
+			return v, nil
+		}
+		l := p.lines[p.i]
+		if err := p.checkIndent(l); err != nil {
+			return nil, err
+		}
+		if l.indent > indent {
+			return nil, p.errorf(l, "unexpected indentation")
+		}
+		if !isYAMLSequenceItem(l.text) {
+			// A mapping key at the same indentation ends a sequence that is the value of a key
+			return v, nil
+		}
+
+		var e *configValue
+		var err error
+		rest := strings.TrimLeft(l.text[1:], " ")
+		if rest == "" {
+			p.i++
+			e, err = p.node(indent + 1)
+		} else {
+			// The rest of the line is a node indented by its column, e.g. the first key of a mapping
+			p.lines[p.i].indent += len(l.text) - len(rest)
+			p.lines[p.i].text = rest
+			e, err = p.node(p.lines[p.i].indent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if e != nil {
+			v.list = append(v.list, e)
+		}
+	}
+}
+
+// blockScalar reads a literal (|) or folded (>) block scalar whose header is on the line l of a key indented by indent.
+func (p *yamlParser) blockScalar(l yamlLine, header string, indent int) (*configValue, error) {
+	folded := header[0] == '>'
+	chomp := header[1:]
+	if chomp != "" && chomp != "-" && chomp != "+" {
+		return nil, p.errorf(l, "unsupported block scalar header %s", strconv.Quote(header))
+	}
+
+	var lines []string
+	block := -1
+	for ; p.i < len(p.lines); p.i++ {
+		raw := p.lines[p.i].raw
+		text := strings.TrimLeft(raw, " ")
+		if text == "" {
+			lines = append(lines, "")
+			continue
+		}
+		n := len(raw) - len(text)
+		if n <= indent || (block >= 0 && n < block) {
+			break
+		}
+		if block < 0 {
+			block = n
+		}
+		lines = append(lines, raw[block:])
+	}
+	// Trailing blank lines only matter for keep chomping (|+)
+	trailing := 0
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+		trailing++
+	}
+
+	var sb strings.Builder
+	for i, line := range lines {
+		switch {
+		case i == 0:
+		case !folded:
+			sb.WriteByte('\n')
+		case lines[i-1] == "" && line != "":
+			// Folding turns n blank lines into n line breaks, already written for the blank lines
+		case line == "" || strings.HasPrefix(line, " ") || strings.HasPrefix(lines[i-1], " "):
+			sb.WriteByte('\n')
+		default:
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(line)
+	}
+	switch {
+	case len(lines) == 0:
+	case chomp == "":
+		sb.WriteByte('\n')
+	case chomp == "+":
+		sb.WriteString(strings.Repeat("\n", trailing+1))
+	}
+	return &configValue{value: sb.String(), pos: p.pos(l)}, nil
+}
+
+// splitEntry splits the line l into the key and the rest of a mapping entry ("key: value").
+// ok is false if the line is not a mapping entry.
+func (p *yamlParser) splitEntry(l yamlLine) (key, rest string, ok bool, err error) {
+	text := l.text
+	switch {
+	case text == "" || isYAMLSequenceItem(text) || strings.ContainsRune("[{", rune(text[0])):
+		return "", "", false, nil
+	case strings.HasPrefix(text, "? "):
+		return "", "", false, p.errorf(l, "complex keys are not supported")
+	case text[0] == '"' || text[0] == '\'':
+		s, n, err := yamlQuoted(text)
+		if err != nil {
+			return "", "", false, p.errorf(l, "%v", err)
+		}
+		after := strings.TrimLeft(text[n:], " ")
+		if !strings.HasPrefix(after, ":") || (len(after) > 1 && after[1] != ' ') {
+			return "", "", false, nil
+		}
+		return s, strings.TrimSpace(after[1:]), true, nil
+	}
+	for i := 0; i < len(text); i++ {
+		if text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ') {
+			key = strings.TrimRight(text[:i], " ")
+			if key == "" {
+				return "", "", false, p.errorf(l, "expected a key")
+			}
+			if strings.ContainsRune("&*!", rune(key[0])) {
+				return "", "", false, p.errorf(l, "anchors, aliases and tags are not supported")
+			}
+			return key, strings.TrimSpace(text[i+1:]), true, nil
+		}
+	}
+	return "", "", false, nil
+}
+
+// inline reads the value text on the line l: a flow collection, a quoted scalar or a plain scalar.
+func (p *yamlParser) inline(l yamlLine, text string) (*configValue, error) {
+	f := &yamlFlow{src: text, pos: p.pos(l)}
+	v, err := f.value(false)
+	if err == nil {
+		if f.skipBlanks(); f.i < len(f.src) {
+			err = fmt.Errorf("unexpected %s after the value", strconv.Quote(f.src[f.i:]))
+		}
+	}
+	if err != nil {
+		return nil, p.errorf(l, "%v", err)
+	}
+	return v, nil
+}
+
+// yamlFlow reads a value on a single line, including flow sequences ([a, b]) and mappings ({a: 1}).
+type yamlFlow struct {
+	src string
+	i   int
+	pos string
+}
+
+func (f *yamlFlow) skipBlanks() {
+	for f.i < len(f.src) && f.src[f.i] == ' ' {
+		f.i++
+	}
+}
+
+// value reads a value. Inside a flow collection, plain scalars end at a comma or a closing bracket.
+// It returns nil for null.
+func (f *yamlFlow) value(inFlow bool) (*configValue, error) {
+	f.skipBlanks()
+	if f.i >= len(f.src) {
+		return nil, nil
+	}
+	switch c := f.src[f.i]; c {
+	case '[':
+		f.i++
+		v := &configValue{kind: configList, pos: f.pos}
+		for {
+			f.skipBlanks()
+			if f.i < len(f.src) && f.src[f.i] == ']' {
+				f.i++
+				return v, nil
+			}
+			e, err := f.value(true)
+			if err != nil {
+				return nil, err
+			}
+			if e != nil {
+				v.list = append(v.list, e)
+			}
+			if err := f.separator(']'); err != nil {
+				return nil, err
+			}
+		}
+	case '{':
+		f.i++
+		v := newConfigTable(f.pos)
+		for {
+			f.skipBlanks()
+			if f.i < len(f.src) && f.src[f.i] == '}' {
+				f.i++
+				return v, nil
+			}
+			k, err := f.value(true)
+			if err != nil {
+				return nil, err
+			}
+			f.skipBlanks()
+			if k == nil || k.kind != configScalar || f.i >= len(f.src) || f.src[f.i] != ':' {
+				return nil, fmt.Errorf("expected a key followed by : in a flow mapping")
+			}
+			f.i++
+			e, err := f.value(true)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := v.table[k.value]; ok {
+				return nil, fmt.Errorf("duplicate key %s", strconv.Quote(k.value))
+			}
+			if e != nil {
+				v.set(k.value, e)
+			}
+			if err := f.separator('}'); err != nil {
+				return nil, err
+			}
+		}
+	case '"', '\'':
+		s, n, err := yamlQuoted(f.src[f.i:])
+		if err != nil {
+			return nil, err
+		}
+		f.i += n
+		return &configValue{value: s, pos: f.pos}, nil
+	case '&', '*', '!':
+		return nil, fmt.Errorf("anchors, aliases and tags are not supported")
+	case '|', '>':
+		if !inFlow {
+			return nil, fmt.Errorf("block scalars must be the value of a key")
+		}
+	}
+
+	start := f.i
+	for f.i < len(f.src) {
+		c := f.src[f.i]
+		if inFlow && (c == ',' || c == ']' || c == '}' || c == ':' && (f.i+1 == len(f.src) || strings.ContainsRune(" ,]}", rune(f.src[f.i+1])))) {
+			break
+		}
+		f.i++
+	}
+	s := strings.TrimRight(f.src[start:f.i], " ")
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil, nil
+	}
+	return &configValue{value: s, pos: f.pos}, nil
+}
+
+// separator reads the comma between the items of a flow collection, or its closing bracket.
+func (f *yamlFlow) separator(end byte) error {
+	f.skipBlanks()
+	switch {
+	case f.i >= len(f.src):
+		return fmt.Errorf("unterminated flow collection, which must be on a single line")
+	case f.src[f.i] == ',':
+		f.i++
+	case f.src[f.i] != end:
+		return fmt.Errorf("expected , or %c in a flow collection", end)
+	}
+	return nil
+}
+
+// yamlQuoted reads the single- or double-quoted scalar at the start of s and returns its value and length.
+func yamlQuoted(s string) (string, int, error) {
+	quote := s[0]
+	var sb strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == quote && quote == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			sb.WriteByte('\'')
+			i++
+		case c == quote:
+			return sb.String(), i + 1, nil
+		case c == '\\' && quote == '"' && i+1 < len(s):
+			i++
+			switch e := s[i]; e {
+			case '0':
+				sb.WriteByte(0)
+			case 'a':
+				sb.WriteByte('\a')
+			case 'b':
+				sb.WriteByte('\b')
+			case 't':
+				sb.WriteByte('\t')
+			case 'n':
+				sb.WriteByte('\n')
+			case 'v':
+				sb.WriteByte('\v')
+			case 'f':
+				sb.WriteByte('\f')
+			case 'r':
+				sb.WriteByte('\r')
+			case 'e':
+				sb.WriteByte(0x1b)
+			case ' ', '"', '/', '\\':
+				sb.WriteByte(e)
+			case 'x', 'u', 'U':
+				n := map[byte]int{'x': 2, 'u': 4, 'U': 8}[e]
+				if i+n >= len(s) {
+					return "", 0, fmt.Errorf("invalid escape sequence \\%c", e)
+				}
+				r, err := strconv.ParseUint(s[i+1:i+1+n], 16, 32)
+				if err != nil || !utf8.ValidRune(rune(r)) {
+					return "", 0, fmt.Errorf("invalid escape sequence \\%c%s", e, s[i+1:i+1+n])
+				}
+				sb.WriteRune(rune(r))
+				i += n
+			default:
+				return "", 0, fmt.Errorf("invalid escape sequence \\%c", e)
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated quoted scalar, which must be on a single line")
+}
+
+func isYAMLSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// yamlStripComment removes a comment from the content of a line. A comment starts with a # at the
+// start of the content or after a blank, outside of quoted scalars.
+func yamlStripComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || strings.IndexByte(" [{,", s[i-1]) >= 0 {
+				quote = c
+			}
+		case c == '#':
+			if i == 0 || s[i-1] == ' ' || s[i-1] == '\t' {
+				return strings.TrimRight(s[:i], " \t")
+			}
+		}
+	}
+	return strings.TrimRight(s, " \t")
+}